@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/pii"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// Ingests a directory straight into the file document store. Stop the
+// server first, or use POST /api/documents/ingest against a running one,
+// since both would otherwise write the same journal.
+func main() {
+	// Read the same .env as the server, so both open the same store with
+	// the same PII settings.
+	_ = godotenv.Load()
+
+	defaultStore := os.Getenv("DOCUMENT_STORE_PATH")
+	if defaultStore == "" {
+		defaultStore = "data/documents"
+	}
+
+	dir := flag.String("dir", "", "directory of Markdown, HTML, text and PDF files to ingest")
+	storePath := flag.String("store", defaultStore, "file document store directory")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := document.OpenFileStore(*storePath)
+	if err != nil {
+		log.Fatalf("Failed to open document store: %v", err)
+	}
+	defer store.Close()
+
+	versions, err := document.OpenFileVersionStore(*storePath)
+	if err != nil {
+		log.Fatalf("Failed to open document version store: %v", err)
+	}
+	defer versions.Close()
+
+	piiAction := os.Getenv("PII_ACTION")
+	if piiAction == "" {
+		piiAction = "mask"
+	}
+	scrubber, err := pii.Configure(piiAction, os.Getenv("PII_RULES"))
+	if err != nil {
+		log.Fatalf("Failed to configure PII scrubbing: %v", err)
+	}
+
+	docRepo := document.NewRepositoryWithStore(store, versions)
+	if scrubber != nil {
+		docRepo.UseSanitizer(scrubber)
+	}
+
+	report, err := ingest.NewIngester(docRepo).IngestDir(*dir)
+	if err != nil {
+		log.Fatalf("Ingestion failed: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	log.Printf("Ingested %d files, skipped %d, failed %d", len(report.Ingested), len(report.Skipped), len(report.Failed))
+}
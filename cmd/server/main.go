@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/basic_llm_completion"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/chunking"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/evaluation"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/function_calling"
@@ -17,6 +19,10 @@ import (
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/reasoning_agent"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tool"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/api/handlers"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/connector"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/dedup"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/pii"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
 	"github.com/junjie-w/llm-integration-patterns-experiments/pkg/config"
 )
@@ -30,15 +36,75 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	docRepo := document.NewRepository()
-	document.SeedDocuments(docRepo)
+	docStore, versionStore, created, err := openDocumentStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open document store: %v", err)
+	}
+	defer docStore.Close()
+	defer versionStore.Close()
+
+	docRepo := document.NewRepositoryWithStore(docStore, versionStore)
+	// The scrubber goes in before anything is seeded, imported or synced.
+	scrubber, err := pii.Configure(cfg.PIIAction, cfg.PIIRulesPath)
+	if err != nil {
+		log.Fatalf("Failed to configure PII scrubbing: %v", err)
+	}
+	if scrubber != nil {
+		docRepo.UseSanitizer(scrubber)
+	}
+	if created {
+		document.SeedDocuments(docRepo)
+	}
 
 	toolRegistry := tool.NewRegistry()
 	tool.RegisterSupportTools(toolRegistry)
 
 	basicLLMCompletionService := basic_llm_completion.NewService(cfg)
-	embeddingService := embeddings.NewService(cfg)
-	knowledgeService := knowledge_rag.NewService(cfg, docRepo, embeddingService)
+	chunker, err := chunking.New(chunking.Strategy(cfg.ChunkStrategy), cfg.ChunkSize, cfg.ChunkOverlap)
+	if err != nil {
+		log.Fatalf("Invalid chunking configuration: %v", err)
+	}
+	chunkStore := chunking.NewStore(chunker)
+	docRepo.Subscribe(chunkStore.HandleDocumentChange)
+
+	embeddingService, err := embeddings.NewService(cfg)
+	if err != nil {
+		log.Fatalf("Invalid embedding configuration: %v", err)
+	}
+	embeddingService.UseChunks(chunkStore.ChunksFor)
+	docRepo.Subscribe(embeddingService.HandleDocumentChange)
+	if cfg.VectorSnapshotPath != "" {
+		if err := importSnapshot(cfg.VectorSnapshotPath, embeddingService, docRepo); err != nil {
+			log.Fatalf("Failed to import vector index snapshot: %v", err)
+		}
+	}
+	connectorManager := connector.NewManager(docRepo)
+	if cfg.ConnectorsConfig != "" {
+		if err := registerConnectors(cfg.ConnectorsConfig, connectorManager); err != nil {
+			log.Fatalf("Failed to configure connectors: %v", err)
+		}
+		connectorManager.Start(context.Background())
+	}
+	duplicateDetector := dedup.NewDetector(docRepo, embeddingService, dedup.DefaultOptions())
+	docRepo.Subscribe(duplicateDetector.HandleDocumentChange)
+	duplicateDetector.Start(context.Background())
+
+	knowledgeService := knowledge_rag.NewService(cfg, docRepo, embeddingService, chunkStore, duplicateDetector)
+	if cfg.QueryLogPath != "" {
+		queryLog, err := knowledge_rag.OpenQueryLog(cfg.QueryLogPath)
+		if err != nil {
+			log.Fatalf("Failed to open query log: %v", err)
+		}
+		defer queryLog.Close()
+		knowledgeService.UseQueryLog(queryLog)
+	}
+	if cfg.CalibrationPath != "" {
+		calibrations, err := knowledge_rag.OpenCalibrations(cfg.CalibrationPath)
+		if err != nil {
+			log.Fatalf("Failed to load similarity calibrations: %v", err)
+		}
+		knowledgeService.UseCalibrations(calibrations)
+	}
 	functionCallingService := function_calling.NewService(cfg, toolRegistry)
 	reasoningAgentService := reasoning_agent.NewService(cfg, toolRegistry)
 	multiAgentService := multi_agent.NewService(cfg)
@@ -54,11 +120,21 @@ func main() {
 	basicLLMCompletionHandler := handlers.NewBasicLLMCompletionHandler(basicLLMCompletionService)
 	knowledgeHandler := handlers.NewKnowledgeRagHandler(knowledgeService)
 	functionCallingHandler := handlers.NewFunctionCallingHandler(functionCallingService)
- 	reasoningAgentHandler := handlers.NewReasoningAgentHandler(reasoningAgentService)
-  multiAgentHandler := handlers.NewMultiAgentHandler(multiAgentService)
+	reasoningAgentHandler := handlers.NewReasoningAgentHandler(reasoningAgentService)
+	multiAgentHandler := handlers.NewMultiAgentHandler(multiAgentService)
 	evaluationHandler := handlers.NewEvaluationHandler(evaluationService)
+	embeddingsHandler := handlers.NewEmbeddingsHandler(embeddingService, docRepo, chunkStore)
+	documentsHandler := handlers.NewDocumentsHandler(docRepo)
+	ingestHandler := handlers.NewIngestHandler(ingest.NewIngester(docRepo))
+	connectorsHandler := handlers.NewConnectorsHandler(connectorManager)
+	duplicatesHandler := handlers.NewDuplicatesHandler(duplicateDetector)
 
 	r := gin.Default()
+	r.Use(handlers.Authenticate(cfg.APIKeys))
+	if len(cfg.APIKeys) == 0 {
+		log.Printf("API_KEYS is not set: every caller is public and the admin endpoints are unavailable")
+	}
+	admin := handlers.RequireAdmin()
 
 	r.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "This project explores practical AI development patterns in a customer support API scenario. Welcome:)")
@@ -68,6 +144,13 @@ func main() {
 	{
 		api.POST("/basic-llm-completion", basicLLMCompletionHandler.HandleBasicLLMCompletion)
 		api.POST("/knowledge-rag", knowledgeHandler.HandleKnowledgeRagCompletion)
+		api.POST("/knowledge-rag/explain", admin, knowledgeHandler.HandleExplain)
+		api.GET("/knowledge-rag/conversations/:id", knowledgeHandler.HandleGetConversation)
+		api.DELETE("/knowledge-rag/conversations/:id", knowledgeHandler.HandleDeleteConversation)
+		api.GET("/knowledge-rag/unanswered", admin, knowledgeHandler.HandleListUnanswered)
+		api.GET("/knowledge-rag/gaps", admin, knowledgeHandler.HandleGetGaps)
+		api.GET("/knowledge-rag/calibration", knowledgeHandler.HandleGetCalibration)
+		api.POST("/knowledge-rag/calibration", admin, knowledgeHandler.HandleCalibrate)
 		api.POST("/function-calling", functionCallingHandler.HandleFunctionCallingCompletion)
 		api.POST("/reasoning-agent", reasoningAgentHandler.HandleReasoningAgentExecution)
 		api.POST("/multi-agent", multiAgentHandler.HandleMultiAgentProcess)
@@ -75,6 +158,39 @@ func main() {
 		api.GET("/evaluate/report/:id", evaluationHandler.HandleGetReport)
 	}
 
+	r.POST("/api/search", embeddingsHandler.HandleSearch)
+
+	documentsAPI := r.Group("/api/documents")
+	{
+		documentsAPI.GET("", documentsHandler.HandleListDocuments)
+		documentsAPI.POST("", admin, documentsHandler.HandleCreateDocument)
+		documentsAPI.GET("/search", documentsHandler.HandleSearchDocuments)
+		documentsAPI.GET("/duplicates", admin, duplicatesHandler.HandleGetDuplicates)
+		documentsAPI.POST("/ingest", admin, ingestHandler.HandleIngestUploads)
+		documentsAPI.GET("/:id", documentsHandler.HandleGetDocument)
+		documentsAPI.PUT("/:id", admin, documentsHandler.HandleUpdateDocument)
+		documentsAPI.DELETE("/:id", admin, documentsHandler.HandleDeleteDocument)
+		documentsAPI.GET("/:id/versions", admin, documentsHandler.HandleListVersions)
+		documentsAPI.GET("/:id/versions/:version", admin, documentsHandler.HandleGetVersion)
+		documentsAPI.POST("/:id/versions/:version/rollback", admin, documentsHandler.HandleRollback)
+	}
+
+	connectorsAPI := r.Group("/api/connectors", admin)
+	{
+		connectorsAPI.GET("", connectorsHandler.HandleListConnectors)
+		connectorsAPI.POST("/:name/sync", connectorsHandler.HandleSync)
+	}
+
+	embeddingsAPI := r.Group("/api/embeddings")
+	{
+		embeddingsAPI.POST("", handlers.RequireKey(), embeddingsHandler.HandleEmbed)
+		embeddingsAPI.GET("/index", embeddingsHandler.HandleGetIndex)
+		embeddingsAPI.GET("/snapshot", admin, embeddingsHandler.HandleExportSnapshot)
+		embeddingsAPI.POST("/snapshot", admin, embeddingsHandler.HandleImportSnapshot)
+		embeddingsAPI.POST("/migrations", admin, embeddingsHandler.HandleStartMigration)
+		embeddingsAPI.GET("/migrations/current", embeddingsHandler.HandleGetMigration)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -85,3 +201,62 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// openDocumentStore also reports whether the store is new, so the sample
+// documents go into a fresh store only and not back into one that was
+// emptied on purpose.
+func openDocumentStore(cfg *config.Config) (document.Store, document.VersionStore, bool, error) {
+	if cfg.DocumentStore != "file" {
+		return document.NewMemoryStore(), document.NewMemoryVersionStore(), true, nil
+	}
+
+	log.Printf("Using file document store at %s", cfg.DocumentStorePath)
+	store, err := document.OpenFileStore(cfg.DocumentStorePath)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	versions, err := document.OpenFileVersionStore(cfg.DocumentStorePath)
+	if err != nil {
+		store.Close()
+		return nil, nil, false, err
+	}
+	return store, versions, store.Created(), nil
+}
+
+func registerConnectors(path string, manager *connector.Manager) error {
+	specs, err := connector.LoadSpecs(path)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		c, err := connector.New(spec)
+		if err != nil {
+			return err
+		}
+		manager.Register(c, spec.Interval)
+		log.Printf("Registered %s connector %s, syncing every %s", spec.Type, spec.Name, spec.Interval)
+	}
+	return nil
+}
+
+func importSnapshot(path string, embeddingService *embeddings.Service, docRepo *document.Repository) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, docs, err := embeddingService.ImportSnapshot(f)
+	if err != nil {
+		return err
+	}
+
+	added, failed := embeddingService.AddSnapshotDocuments(docRepo, docs)
+	for _, f := range failed {
+		log.Printf("Skipping snapshot document %s: %s", f.DocumentID, f.Error)
+	}
+
+	log.Printf("Imported %d documents embedded with %s from %s", added, header.Model, path)
+	return nil
+}
@@ -0,0 +1,250 @@
+package chunking
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tokens"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+type Strategy string
+
+const (
+	StrategyFixed    Strategy = "fixed"
+	StrategySentence Strategy = "sentence"
+	StrategyMarkdown Strategy = "markdown"
+)
+
+// Chunker splits a document into chunks. Sizes are measured in tokens of
+// the embedding models' tokenizer, as chunks are embedded whole. Chunks only
+// break between words.
+type Chunker interface {
+	Chunk(doc document.Document) []document.Chunk
+}
+
+func New(strategy Strategy, size, overlap int) (Chunker, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive")
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and size-1")
+	}
+
+	switch strategy {
+	case StrategyFixed:
+		return &FixedChunker{Size: size, Overlap: overlap}, nil
+	case StrategySentence, "":
+		return &SentenceChunker{MaxTokens: size, Overlap: overlap}, nil
+	case StrategyMarkdown:
+		return &MarkdownChunker{Sections: &SentenceChunker{MaxTokens: size, Overlap: overlap}}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunking strategy %q", strategy)
+	}
+}
+
+// FixedChunker emits windows of whole words up to Size tokens, each
+// repeating up to Overlap tokens from the end of the previous one.
+type FixedChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c *FixedChunker) Chunk(doc document.Document) []document.Chunk {
+	return build(doc, "", fixedWindows(doc.Content, c.Size, c.Overlap), 0)
+}
+
+// fixedWindows splits text into windows of at most size tokens. A single
+// word longer than size makes a window of its own.
+func fixedWindows(text string, size, overlap int) []string {
+	words := strings.Fields(text)
+	counts := make([]int, len(words))
+	for i, word := range words {
+		counts[i] = countTokens(word)
+	}
+
+	var windows []string
+	for start := 0; start < len(words); {
+		end, n := start, 0
+		for end < len(words) && (end == start || n+counts[end] <= size) {
+			n += counts[end]
+			end++
+		}
+		windows = append(windows, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+
+		// Step back over the overlap, but always move past start.
+		next, carried := end, 0
+		for next-1 > start && carried+counts[next-1] <= overlap {
+			next--
+			carried += counts[next]
+		}
+		start = next
+	}
+	return windows
+}
+
+var sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+
+// SentenceChunker packs whole sentences into chunks of at most MaxTokens,
+// repeating trailing sentences worth up to Overlap tokens at the start of
+// the next chunk. A single sentence longer than MaxTokens is split into
+// fixed windows.
+type SentenceChunker struct {
+	MaxTokens int
+	Overlap   int
+}
+
+func (c *SentenceChunker) Chunk(doc document.Document) []document.Chunk {
+	return build(doc, "", c.split(doc.Content), 0)
+}
+
+func (c *SentenceChunker) split(text string) []string {
+	var chunks []string
+	var current []string
+	tokens := 0
+	// fresh is false while current only holds sentences carried over as
+	// overlap, which must not become a chunk of their own.
+	fresh := false
+
+	flush := func() {
+		if !fresh {
+			return
+		}
+		chunks = append(chunks, strings.Join(current, " "))
+
+		var carried []string
+		carriedTokens := 0
+		for i := len(current) - 1; i >= 0; i-- {
+			n := countTokens(current[i])
+			if carriedTokens+n > c.Overlap {
+				break
+			}
+			carried = append([]string{current[i]}, carried...)
+			carriedTokens += n
+		}
+		current, tokens, fresh = carried, carriedTokens, false
+	}
+
+	for _, sentence := range splitSentences(text) {
+		n := countTokens(sentence)
+		if n > c.MaxTokens {
+			flush()
+			chunks = append(chunks, fixedWindows(sentence, c.MaxTokens, c.Overlap)...)
+			current, tokens = nil, 0
+			continue
+		}
+
+		if tokens+n > c.MaxTokens {
+			flush()
+			for tokens+n > c.MaxTokens && len(current) > 0 {
+				tokens -= countTokens(current[0])
+				current = current[1:]
+			}
+		}
+		current = append(current, sentence)
+		tokens += n
+		fresh = true
+	}
+	flush()
+
+	return chunks
+}
+
+func splitSentences(text string) []string {
+	var sentences []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+		last := 0
+		for _, loc := range sentenceEnd.FindAllStringIndex(paragraph+" ", -1) {
+			end := min(loc[1], len(paragraph))
+			if s := strings.TrimSpace(paragraph[last:end]); s != "" {
+				sentences = append(sentences, s)
+			}
+			last = end
+		}
+		if s := strings.TrimSpace(paragraph[last:]); s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+	return sentences
+}
+
+// MarkdownChunker keeps each heading section together and only splits
+// sections that are too long, labelling every chunk with its heading.
+type MarkdownChunker struct {
+	Sections *SentenceChunker
+}
+
+func (c *MarkdownChunker) Chunk(doc document.Document) []document.Chunk {
+	var chunks []document.Chunk
+	for _, section := range splitSections(doc.Content) {
+		chunks = append(chunks, build(doc, section.heading, c.Sections.split(section.body), len(chunks))...)
+	}
+	return chunks
+}
+
+type section struct {
+	heading string
+	body    string
+}
+
+func splitSections(text string) []section {
+	var sections []section
+	current := section{}
+	var body []string
+	inFence := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+
+		if !inFence && strings.HasPrefix(line, "#") {
+			heading := strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if heading != "" && strings.HasPrefix(strings.TrimLeft(line, "#"), " ") {
+				current.body = strings.Join(body, "\n")
+				sections = append(sections, current)
+				current, body = section{heading: heading}, nil
+				continue
+			}
+		}
+		body = append(body, line)
+	}
+
+	current.body = strings.Join(body, "\n")
+	sections = append(sections, current)
+
+	nonEmpty := sections[:0]
+	for _, s := range sections {
+		if strings.TrimSpace(s.body) != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return nonEmpty
+}
+
+func build(doc document.Document, heading string, texts []string, offset int) []document.Chunk {
+	chunks := make([]document.Chunk, 0, len(texts))
+	for i, text := range texts {
+		chunks = append(chunks, document.Chunk{
+			ID:         document.ChunkID(doc.ID, offset+i),
+			DocumentID: doc.ID,
+			Index:      offset + i,
+			Heading:    heading,
+			Content:    text,
+		})
+	}
+	return chunks
+}
+
+// tokenizerModel picks the tokenizer: every supported embedding model uses
+// cl100k_base.
+const tokenizerModel = "text-embedding-ada-002"
+
+func countTokens(text string) int {
+	return tokens.ForModel(tokenizerModel).Count(text)
+}
@@ -0,0 +1,122 @@
+package chunking
+
+import (
+	"sync"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// Store holds the chunks of each document, keyed by parent document ID.
+// Chunks are rebuilt when the repository reports a change and, as a
+// fallback, whenever a document is requested whose content no longer
+// matches what was chunked.
+type Store struct {
+	chunker  Chunker
+	chunks   map[string][]document.Chunk
+	sources  map[string]string
+	keywords *search.Index
+	mu       sync.RWMutex
+}
+
+func NewStore(chunker Chunker) *Store {
+	return &Store{
+		chunker:  chunker,
+		chunks:   make(map[string][]document.Chunk),
+		sources:  make(map[string]string),
+		keywords: search.NewIndex(),
+	}
+}
+
+// KeywordResult is a chunk ranked by BM25 against a keyword query.
+type KeywordResult struct {
+	Chunk   document.Chunk `json:"chunk"`
+	Score   float64        `json:"score"`
+	Snippet string         `json:"snippet"`
+}
+
+func (s *Store) HandleDocumentChange(change document.Change) {
+	if change.Type == document.ChangeDeleted {
+		s.mu.Lock()
+		s.forget(change.Document.ID)
+		s.mu.Unlock()
+		return
+	}
+
+	s.rebuild(change.Document)
+}
+
+// ChunksFor returns the chunks of docs in document order.
+func (s *Store) ChunksFor(docs []document.Document) []document.Chunk {
+	var chunks []document.Chunk
+	for _, doc := range docs {
+		chunks = append(chunks, s.chunksOf(doc)...)
+	}
+	return chunks
+}
+
+// Search ranks the chunks of docs against query with BM25 and returns at
+// most limit of them.
+func (s *Store) Search(query string, docs []document.Document, limit int) []KeywordResult {
+	chunks := make(map[string]document.Chunk)
+	for _, chunk := range s.ChunksFor(docs) {
+		chunks[chunk.ID] = chunk
+	}
+
+	hits := s.keywords.Search(query, limit, func(id string) bool {
+		_, ok := chunks[id]
+		return ok
+	})
+
+	results := make([]KeywordResult, len(hits))
+	for i, hit := range hits {
+		chunk := chunks[hit.ID]
+		results[i] = KeywordResult{
+			Chunk:   chunk,
+			Score:   hit.Score,
+			Snippet: search.Snippet(chunk.Content, query),
+		}
+	}
+	return results
+}
+
+func (s *Store) chunksOf(doc document.Document) []document.Chunk {
+	s.mu.RLock()
+	chunks, exists := s.chunks[doc.ID]
+	current := exists && s.sources[doc.ID] == doc.Content
+	s.mu.RUnlock()
+
+	if current {
+		return chunks
+	}
+	return s.rebuild(doc)
+}
+
+func (s *Store) rebuild(doc document.Document) []document.Chunk {
+	chunks := s.chunker.Chunk(doc)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forget(doc.ID)
+	for _, chunk := range chunks {
+		s.keywords.Put(chunk.ID, keywordText(doc, chunk))
+	}
+	s.chunks[doc.ID] = chunks
+	s.sources[doc.ID] = doc.Content
+	return chunks
+}
+
+func (s *Store) forget(documentID string) {
+	for _, chunk := range s.chunks[documentID] {
+		s.keywords.Remove(chunk.ID)
+	}
+	delete(s.chunks, documentID)
+	delete(s.sources, documentID)
+}
+
+// keywordText prefixes a chunk with its document title and heading, which
+// the chunk text itself usually lacks.
+func keywordText(doc document.Document, chunk document.Chunk) string {
+	return doc.Title + "\n" + chunk.Heading + "\n" + chunk.Content
+}
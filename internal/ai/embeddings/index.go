@@ -0,0 +1,189 @@
+package embeddings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrModelMismatch     = errors.New("embedding model does not match index model")
+	ErrDimensionMismatch = errors.New("embedding dimension does not match index dimension")
+	ErrUnsupportedModel  = errors.New("unsupported embedding model")
+	ErrInputTooLong      = errors.New("input exceeds the embedding token limit")
+)
+
+var modelDimensions = map[string]int{
+	"text-embedding-ada-002": 1536,
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+}
+
+func IsSupportedModel(model string) bool {
+	_, ok := modelDimensions[model]
+	return ok
+}
+
+type IndexOptions struct {
+	Metric    Metric `json:"metric"`
+	Normalize bool   `json:"normalize"`
+}
+
+// Index holds the vectors produced by a single embedding model. Vectors from
+// different models live in different indexes and are never compared.
+type Index struct {
+	ID        string
+	Model     string
+	Dimension int
+	Metric    Metric
+	Normalize bool
+	CreatedAt time.Time
+
+	entries map[string]entry
+	mu      sync.RWMutex
+}
+
+// entry remembers a hash of the text that was embedded so edits to a
+// document or chunk are detected even if no change notification reached the
+// index.
+type entry struct {
+	vector      []float32
+	contentHash string
+}
+
+type IndexInfo struct {
+	ID        string    `json:"id"`
+	Model     string    `json:"model"`
+	Dimension int       `json:"dimension"`
+	Metric    Metric    `json:"metric"`
+	Normalize bool      `json:"normalize"`
+	Documents int       `json:"documents"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewIndex(model string, opts IndexOptions) *Index {
+	if opts.Metric == "" {
+		opts.Metric = MetricCosine
+	}
+
+	return &Index{
+		ID:        uuid.New().String(),
+		Model:     model,
+		Dimension: modelDimensions[model],
+		Metric:    opts.Metric,
+		Normalize: opts.Normalize,
+		CreatedAt: time.Now(),
+		entries:   make(map[string]entry),
+	}
+}
+
+func (idx *Index) Options() IndexOptions {
+	return IndexOptions{Metric: idx.Metric, Normalize: idx.Normalize}
+}
+
+// Put stores the vector embedded from text under id. Documents and their
+// chunks share an index; their IDs never collide.
+func (idx *Index) Put(id, text string, vector []float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.Dimension == 0 {
+		idx.Dimension = len(vector)
+	}
+	if len(vector) != idx.Dimension {
+		return fmt.Errorf("%w: got %d, index %s expects %d", ErrDimensionMismatch, len(vector), idx.Model, idx.Dimension)
+	}
+
+	if idx.Normalize {
+		vector = normalize(vector)
+	}
+
+	idx.entries[id] = entry{vector: vector, contentHash: contentHash(text)}
+	return nil
+}
+
+// Score compares a query vector against a stored vector using the index
+// metric, normalizing the query the same way stored vectors were.
+func (idx *Index) Score(query, vector []float32) (float32, error) {
+	idx.mu.RLock()
+	dimension := idx.Dimension
+	idx.mu.RUnlock()
+
+	if dimension != 0 && len(query) != dimension {
+		return 0, fmt.Errorf("%w: query has %d, index %s expects %d", ErrDimensionMismatch, len(query), idx.Model, dimension)
+	}
+
+	if idx.Normalize {
+		query = normalize(query)
+	}
+
+	return idx.Metric.Similarity(query, vector)
+}
+
+func (idx *Index) Get(id string) ([]float32, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	e, exists := idx.entries[id]
+	return e.vector, exists
+}
+
+// IsCurrent reports whether id has a vector embedded from text.
+func (idx *Index) IsCurrent(id, text string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	e, exists := idx.entries[id]
+	return exists && e.contentHash == contentHash(text)
+}
+
+func (idx *Index) Delete(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.entries, id)
+}
+
+func (idx *Index) DeletePrefix(prefix string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for id := range idx.entries {
+		if strings.HasPrefix(id, prefix) {
+			delete(idx.entries, id)
+		}
+	}
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.entries)
+}
+
+func (idx *Index) Info() IndexInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return IndexInfo{
+		ID:        idx.ID,
+		Model:     idx.Model,
+		Dimension: idx.Dimension,
+		Metric:    idx.Metric,
+		Normalize: idx.Normalize,
+		Documents: len(idx.entries),
+		CreatedAt: idx.CreatedAt,
+	}
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
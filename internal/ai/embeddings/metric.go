@@ -0,0 +1,116 @@
+package embeddings
+
+import (
+	"fmt"
+	"math"
+)
+
+type Metric string
+
+const (
+	MetricCosine     Metric = "cosine"
+	MetricDotProduct Metric = "dot_product"
+	MetricEuclidean  Metric = "euclidean"
+)
+
+func ParseMetric(name string) (Metric, error) {
+	switch Metric(name) {
+	case "":
+		return MetricCosine, nil
+	case MetricCosine, MetricDotProduct, MetricEuclidean:
+		return Metric(name), nil
+	default:
+		return "", fmt.Errorf("unknown similarity metric %q", name)
+	}
+}
+
+// Similarity scores a against b so that higher always means closer.
+// Euclidean distance d is mapped to 1/(1+d) to keep that ordering and a
+// 0..1 range comparable with cosine thresholds.
+func (m Metric) Similarity(a, b []float32) (float32, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("%w: %d vs %d", ErrDimensionMismatch, len(a), len(b))
+	}
+
+	switch m {
+	case MetricDotProduct:
+		return dotProduct(a, b), nil
+	case MetricEuclidean:
+		return 1 / (1 + sqrt(squaredDistance(a, b))), nil
+	default:
+		return cosineSimilarity(a, b), nil
+	}
+}
+
+func normalize(v []float32) []float32 {
+	norm := sqrt(dotProduct(v, v))
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	normA := dotProduct(a, a)
+	normB := dotProduct(b, b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dotProduct(a, b) / (sqrt(normA) * sqrt(normB))
+}
+
+// dotProduct and squaredDistance use four independent accumulators over
+// bounds-check-free slices so the compiler can keep them in registers and
+// pipeline the multiplies. Callers must pass equal-length slices.
+func dotProduct(a, b []float32) float32 {
+	n := len(a)
+	b = b[:n]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < n; i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return s0 + s1 + s2 + s3
+}
+
+func squaredDistance(a, b []float32) float32 {
+	n := len(a)
+	b = b[:n]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < n; i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+
+	return s0 + s1 + s2 + s3
+}
+
+func sqrt(x float32) float32 {
+	return float32(math.Sqrt(float64(x)))
+}
@@ -0,0 +1,126 @@
+package embeddings
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// naiveDotProduct and naiveSquaredDistance are the plain loops the unrolled
+// kernels replace; they are the reference for both tests and benchmarks.
+func naiveDotProduct(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func naiveSquaredDistance(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		d := a[i] - b[i]
+		s += d * d
+	}
+	return s
+}
+
+func randomVectors(n int, seed int64) ([]float32, []float32) {
+	rng := rand.New(rand.NewSource(seed))
+	a := make([]float32, n)
+	b := make([]float32, n)
+	for i := range a {
+		a[i] = rng.Float32()*2 - 1
+		b[i] = rng.Float32()*2 - 1
+	}
+	return a, b
+}
+
+// closeEnough allows for the different summation order of the unrolled
+// kernels, which changes float32 rounding.
+func closeEnough(got, want float32) bool {
+	return math.Abs(float64(got-want)) <= 1e-4*math.Max(1, math.Abs(float64(want)))
+}
+
+// The lengths cover empty and short vectors, every remainder of the unroll
+// factor of four and the real model dimensions.
+var kernelLengths = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 15, 17, 1023, 1536, 3072}
+
+func TestDotProductMatchesNaive(t *testing.T) {
+	for _, n := range kernelLengths {
+		a, b := randomVectors(n, int64(n))
+		if got, want := dotProduct(a, b), naiveDotProduct(a, b); !closeEnough(got, want) {
+			t.Errorf("dotProduct with length %d = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestSquaredDistanceMatchesNaive(t *testing.T) {
+	for _, n := range kernelLengths {
+		a, b := randomVectors(n, int64(n))
+		if got, want := squaredDistance(a, b), naiveSquaredDistance(a, b); !closeEnough(got, want) {
+			t.Errorf("squaredDistance with length %d = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := []float32{1, 0, 0, 0, 0}
+	b := []float32{0, 1, 0, 0, 0}
+
+	tests := []struct {
+		metric Metric
+		a, b   []float32
+		want   float32
+	}{
+		{MetricCosine, a, a, 1},
+		{MetricCosine, a, b, 0},
+		{MetricCosine, a, make([]float32, 5), 0},
+		{MetricDotProduct, []float32{1, 2, 3, 4, 5}, []float32{5, 4, 3, 2, 1}, 35},
+		{MetricEuclidean, a, a, 1},
+		{MetricEuclidean, []float32{0, 0, 0, 0, 0}, []float32{3, 4, 0, 0, 0}, 1.0 / 6},
+	}
+	for _, tt := range tests {
+		got, err := tt.metric.Similarity(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.metric, err)
+		}
+		if !closeEnough(got, tt.want) {
+			t.Errorf("%s similarity of %v and %v = %v, want %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if _, err := MetricCosine.Similarity(a, a[:4]); err == nil {
+		t.Error("expected an error for vectors of different lengths")
+	}
+}
+
+var benchmarkSink float32
+
+func BenchmarkDotProduct(b *testing.B) {
+	x, y := randomVectors(1536, 1)
+	b.Run("unrolled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchmarkSink = dotProduct(x, y)
+		}
+	})
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchmarkSink = naiveDotProduct(x, y)
+		}
+	})
+}
+
+func BenchmarkEuclidean(b *testing.B) {
+	x, y := randomVectors(1536, 1)
+	b.Run("unrolled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchmarkSink = squaredDistance(x, y)
+		}
+	})
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchmarkSink = naiveSquaredDistance(x, y)
+		}
+	})
+}
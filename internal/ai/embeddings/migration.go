@@ -0,0 +1,141 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+var ErrMigrationInProgress = errors.New("an embedding migration is already running")
+
+type MigrationState string
+
+const (
+	MigrationRunning   MigrationState = "running"
+	MigrationCompleted MigrationState = "completed"
+	MigrationFailed    MigrationState = "failed"
+)
+
+type Migration struct {
+	ID         string         `json:"id"`
+	FromModel  string         `json:"from_model"`
+	ToModel    string         `json:"to_model"`
+	Options    IndexOptions   `json:"options"`
+	State      MigrationState `json:"state"`
+	Total      int            `json:"total"`
+	Done       int            `json:"done"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// StartMigration re-embeds docs and their chunks with model into a fresh
+// index built with opts in the background. Queries keep using the current
+// index until everything has been embedded, at which point the new index
+// replaces it in one step.
+func (s *Service) StartMigration(model string, opts IndexOptions, docs []document.Document, chunks []document.Chunk) (Migration, error) {
+	if !IsSupportedModel(model) {
+		return Migration{}, fmt.Errorf("%w: %s", ErrUnsupportedModel, model)
+	}
+	if opts.Metric == "" {
+		opts.Metric = MetricCosine
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.migration != nil && s.migration.State == MigrationRunning {
+		return Migration{}, ErrMigrationInProgress
+	}
+
+	current := s.Index()
+	if current.Model == model && current.Options() == opts {
+		return Migration{}, fmt.Errorf("index already uses model %s with these options", model)
+	}
+
+	m := &Migration{
+		ID:        uuid.New().String(),
+		FromModel: current.Model,
+		ToModel:   model,
+		Options:   opts,
+		State:     MigrationRunning,
+		Total:     len(docs) + len(chunks),
+		StartedAt: time.Now(),
+	}
+	s.migration = m
+
+	items := make([]item, 0, len(chunks))
+	for _, chunk := range chunks {
+		items = append(items, chunkItem(chunk))
+	}
+
+	go s.runMigration(m, NewIndex(model, opts), items, docs)
+
+	return *m, nil
+}
+
+func (s *Service) MigrationStatus() (Migration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.migration == nil {
+		return Migration{}, false
+	}
+	return *s.migration, true
+}
+
+// runMigration embeds the chunks first so the document vectors, pooled
+// from them, need no further requests.
+func (s *Service) runMigration(m *Migration, idx *Index, chunks []item, docs []document.Document) {
+	ctx := context.Background()
+
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		batch := chunks[start:min(start+embedBatchSize, len(chunks))]
+		if err := s.ensureIndexed(ctx, idx, batch); err != nil {
+			s.finishMigration(m, err)
+			return
+		}
+
+		s.mu.Lock()
+		m.Done += len(batch)
+		s.mu.Unlock()
+	}
+
+	for start := 0; start < len(docs); start += embedBatchSize {
+		batch := docs[start:min(start+embedBatchSize, len(docs))]
+		if err := s.ensureDocuments(ctx, idx, batch); err != nil {
+			s.finishMigration(m, err)
+			return
+		}
+
+		s.mu.Lock()
+		m.Done += len(batch)
+		s.mu.Unlock()
+	}
+
+	s.index.Store(idx)
+	s.finishMigration(m, nil)
+}
+
+func (s *Service) finishMigration(m *Migration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	m.FinishedAt = &now
+
+	if err != nil {
+		m.State = MigrationFailed
+		m.Error = err.Error()
+		log.Printf("Embedding migration %s to %s failed: %v", m.ID, m.ToModel, err)
+		return
+	}
+
+	m.State = MigrationCompleted
+	log.Printf("Embedding migration %s completed, index now uses %s", m.ID, m.ToModel)
+}
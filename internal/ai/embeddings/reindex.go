@@ -0,0 +1,99 @@
+package embeddings
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+const (
+	// reindexAttempts bounds the tries for one batch of changed documents;
+	// the wait between them doubles from reindexBackoff.
+	reindexAttempts = 5
+	reindexBackoff  = time.Second
+)
+
+// reindexQueue holds the documents waiting to be re-embedded, each at most
+// once: a document changed again before its turn keeps its place and is
+// embedded in its latest version only.
+type reindexQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]document.Document
+	order   []string
+}
+
+func newReindexQueue() *reindexQueue {
+	q := &reindexQueue{pending: make(map[string]document.Document)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *reindexQueue) push(doc document.Document) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, queued := q.pending[doc.ID]; !queued {
+		q.order = append(q.order, doc.ID)
+	}
+	q.pending[doc.ID] = doc
+	q.cond.Signal()
+}
+
+// remove drops a deleted document that has not been embedded yet.
+func (q *reindexQueue) remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.pending, id)
+}
+
+// pop waits for queued documents and takes up to n of them.
+func (q *reindexQueue) pop(n int) []document.Document {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.pending) == 0 {
+		q.cond.Wait()
+	}
+
+	var docs []document.Document
+	for len(q.order) > 0 && len(docs) < n {
+		id := q.order[0]
+		q.order = q.order[1:]
+		if doc, queued := q.pending[id]; queued {
+			docs = append(docs, doc)
+			delete(q.pending, id)
+		}
+	}
+	return docs
+}
+
+// reindex is the single worker that embeds changed documents, a batch at a
+// time, so a bulk import or connector sync queues up instead of firing one
+// request per document at once. A failed batch is retried with backoff.
+func (s *Service) reindex() {
+	ctx := context.Background()
+	for {
+		docs := s.changed.pop(embedBatchSize)
+
+		var err error
+		wait := reindexBackoff
+		for attempt := 1; attempt <= reindexAttempts; attempt++ {
+			if err = s.ensureDocuments(ctx, s.Index(), docs); err == nil {
+				break
+			}
+			if attempt < reindexAttempts {
+				log.Printf("Failed to re-index %d documents, retrying in %s: %v", len(docs), wait, err)
+				time.Sleep(wait)
+				wait *= 2
+			}
+		}
+		if err != nil {
+			log.Printf("Giving up re-indexing %d documents, they are embedded on their next search: %v", len(docs), err)
+		}
+	}
+}
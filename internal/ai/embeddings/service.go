@@ -3,82 +3,379 @@ package embeddings
 import (
 	"context"
 	"fmt"
-	"math"
 	"sort"
+	"sync"
+	"sync/atomic"
 
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tokens"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
 	"github.com/junjie-w/llm-integration-patterns-experiments/pkg/config"
 	"github.com/sashabaranov/go-openai"
 )
 
 type Service struct {
-	client *openai.Client
-	cache  map[string][]float32
+	client    *openai.Client
+	index     atomic.Pointer[Index]
+	migration *Migration
+	// chunksFor returns the chunks of documents, whose vectors a document's
+	// own vector is pooled from.
+	chunksFor func(docs []document.Document) []document.Chunk
+	changed   *reindexQueue
+	mu        sync.Mutex
 }
 
-func NewService(cfg *config.Config) *Service {
+// NewService fails on an unknown model or metric, which would otherwise
+// only show when the first vector does not fit the index.
+func NewService(cfg *config.Config) (*Service, error) {
+	if !IsSupportedModel(cfg.EmbeddingModel) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedModel, cfg.EmbeddingModel)
+	}
+	metric, err := ParseMetric(cfg.EmbeddingMetric)
+	if err != nil {
+		return nil, err
+	}
+
 	client := openai.NewClient(cfg.OpenAIKey)
-	return &Service{
-		client: client,
-		cache:  make(map[string][]float32),
+	s := &Service{
+		client:  client,
+		changed: newReindexQueue(),
 	}
+	s.index.Store(NewIndex(cfg.EmbeddingModel, IndexOptions{
+		Metric:    metric,
+		Normalize: cfg.EmbeddingNormalize,
+	}))
+	go s.reindex()
+	return s, nil
+}
+
+// Index returns the active index. Callers that run several lookups should
+// hold on to the returned value so a migration switching indexes midway
+// cannot mix vectors from two models.
+func (s *Service) Index() *Index {
+	return s.index.Load()
 }
 
 func (s *Service) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return s.createEmbedding(ctx, s.Index().Model, text)
+}
+
+const (
+	// embedBatchSize caps the number of inputs sent in one embeddings
+	// request.
+	embedBatchSize = 100
+
+	// maxInputTokens is the embedding models' limit for a single input.
+	maxInputTokens = 8191
+
+	// maxBatchTokens keeps one request under the API's limit of 300,000
+	// tokens over all its inputs, with room for counting differences.
+	maxBatchTokens = 250000
+)
+
+// UseChunks sets where document chunks come from, so document vectors are
+// pooled from chunk vectors instead of embedding whole documents.
+func (s *Service) UseChunks(chunksFor func(docs []document.Document) []document.Chunk) {
+	s.chunksFor = chunksFor
+}
+
+// EmbedTexts embeds texts with the active index model and returns the
+// vectors in input order together with that model.
+// EmbedTexts embeds caller-supplied texts in one request. Unlike indexed
+// text they are not cut to fit: a text over the model's input limit, or
+// texts over one request's token total, fail with ErrInputTooLong.
+func (s *Service) EmbedTexts(ctx context.Context, texts []string) ([][]float32, string, error) {
+	model := s.Index().Model
+
+	counter := tokens.ForModel(model)
+	total := 0
+	for i, text := range texts {
+		n := counter.Count(text)
+		if n > maxInputTokens {
+			return nil, "", fmt.Errorf("%w: text %d has %d tokens, the limit is %d", ErrInputTooLong, i, n, maxInputTokens)
+		}
+		total += n
+	}
+	if total > maxBatchTokens {
+		return nil, "", fmt.Errorf("%w: the texts have %d tokens together, the limit is %d", ErrInputTooLong, total, maxBatchTokens)
+	}
+
+	vectors, err := s.createEmbeddings(ctx, model, texts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return vectors, model, nil
+}
+
+func (s *Service) createEmbedding(ctx context.Context, model string, text string) ([]float32, error) {
+	vectors, err := s.createEmbeddings(ctx, model, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors[0], nil
+}
+
+func (s *Service) createEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
 	resp, err := s.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.AdaEmbeddingV2,
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create embedding: %w", err)
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embeddings returned")
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
 	}
 
-	return resp.Data[0].Embedding, nil
+	return vectors, nil
 }
 
 func (s *Service) IndexDocument(ctx context.Context, doc document.Document) error {
-	embedding, err := s.GetEmbedding(ctx, doc.Content)
-	if err != nil {
+	return s.indexDocument(ctx, s.Index(), doc)
+}
+
+func (s *Service) indexDocument(ctx context.Context, idx *Index, doc document.Document) error {
+	if err := s.ensureDocuments(ctx, idx, []document.Document{doc}); err != nil {
 		return fmt.Errorf("failed to get embedding for document %s: %w", doc.ID, err)
 	}
+	return nil
+}
+
+// item is anything with an ID and text that can be embedded: a whole
+// document or one of its chunks.
+type item struct {
+	id   string
+	text string
+}
+
+func documentItem(doc document.Document) item {
+	return item{id: doc.ID, text: doc.Content}
+}
+
+func chunkItem(chunk document.Chunk) item {
+	return item{id: chunk.ID, text: chunk.Content}
+}
+
+// ensureIndexed embeds every item whose vector is missing or stale, batching
+// the requests by count and by tokens. Text over the model's input limit is
+// cut to it; the vector is still stored against the full text.
+func (s *Service) ensureIndexed(ctx context.Context, idx *Index, items []item) error {
+	counter := tokens.ForModel(idx.Model)
+
+	var batch []item
+	var texts []string
+	batchTokens := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		vectors, err := s.createEmbeddings(ctx, idx.Model, texts)
+		if err != nil {
+			return err
+		}
+		for i, it := range batch {
+			if err := idx.Put(it.id, it.text, vectors[i]); err != nil {
+				return fmt.Errorf("%s: %w", it.id, err)
+			}
+		}
+		batch, texts, batchTokens = batch[:0], texts[:0], 0
+		return nil
+	}
+
+	for _, it := range items {
+		if idx.IsCurrent(it.id, it.text) {
+			continue
+		}
+
+		text := counter.Truncate(it.text, maxInputTokens)
+		n := counter.Count(text)
+		if len(batch) == embedBatchSize || batchTokens+n > maxBatchTokens {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, it)
+		texts = append(texts, text)
+		batchTokens += n
+	}
+
+	return flush()
+}
+
+// ensureDocuments gives every document in docs a current vector. It is
+// pooled from the vectors of the document's chunks rather than embedded
+// whole: an article can be far longer than the model takes in one input,
+// and its chunks are embedded for retrieval anyway. A document without
+// chunks, or any document when no chunk source is set, is embedded whole,
+// cut to the input limit.
+func (s *Service) ensureDocuments(ctx context.Context, idx *Index, docs []document.Document) error {
+	var stale []document.Document
+	for _, doc := range docs {
+		if !idx.IsCurrent(doc.ID, doc.Content) {
+			stale = append(stale, doc)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	chunksByDoc := make(map[string][]document.Chunk)
+	var items []item
+	if s.chunksFor != nil {
+		for _, chunk := range s.chunksFor(stale) {
+			chunksByDoc[chunk.DocumentID] = append(chunksByDoc[chunk.DocumentID], chunk)
+			items = append(items, chunkItem(chunk))
+		}
+	}
+	for _, doc := range stale {
+		if len(chunksByDoc[doc.ID]) == 0 {
+			items = append(items, documentItem(doc))
+		}
+	}
+	if err := s.ensureIndexed(ctx, idx, items); err != nil {
+		return err
+	}
 
-	s.cache[doc.ID] = embedding
+	for _, doc := range stale {
+		var vectors [][]float32
+		for _, chunk := range chunksByDoc[doc.ID] {
+			if vector, ok := idx.Get(chunk.ID); ok {
+				vectors = append(vectors, vector)
+			}
+		}
+		if len(vectors) == 0 {
+			continue
+		}
+		if err := idx.Put(doc.ID, doc.Content, pool(vectors)); err != nil {
+			return fmt.Errorf("%s: %w", doc.ID, err)
+		}
+	}
 	return nil
 }
 
+// pool averages vectors and scales the mean back to unit length, like the
+// model's own vectors, so every metric treats it as one of them.
+func pool(vectors [][]float32) []float32 {
+	mean := make([]float32, len(vectors[0]))
+	for _, v := range vectors {
+		for i, x := range v {
+			mean[i] += x
+		}
+	}
+	return normalize(mean)
+}
+
+// HandleDocumentChange keeps the active index in step with the document
+// repository. Deleted documents lose their vectors immediately; added or
+// edited ones are queued to be re-embedded in the background. Chunk
+// vectors are kept on edits: each is checked against its content hash when
+// next used, so chunks an edit or a snapshot import leaves unchanged are
+// not embedded again. Anything missed is picked up on the next search.
+func (s *Service) HandleDocumentChange(change document.Change) {
+	idx := s.Index()
+	doc := change.Document
+
+	if change.Type == document.ChangeDeleted {
+		s.changed.remove(doc.ID)
+		forget(idx, doc.ID)
+		return
+	}
+
+	if idx.IsCurrent(doc.ID, doc.Content) {
+		return
+	}
+	s.changed.push(doc)
+}
+
+// forget drops a document's vector and those of its chunks from idx.
+func forget(idx *Index, id string) {
+	idx.Delete(id)
+	idx.DeletePrefix(document.ChunkIDPrefix(id))
+}
+
+// DocumentEmbeddings returns the vectors of docs in order, embedding any
+// that are missing, together with the index they belong to so callers can
+// compare them with its metric.
+func (s *Service) DocumentEmbeddings(ctx context.Context, docs []document.Document) (*Index, [][]float32, error) {
+	idx := s.Index()
+
+	if err := s.ensureDocuments(ctx, idx, docs); err != nil {
+		return nil, nil, err
+	}
+
+	vectors := make([][]float32, len(docs))
+	for i, doc := range docs {
+		vectors[i], _ = idx.Get(doc.ID)
+	}
+	return idx, vectors, nil
+}
+
 type SimilarityResult struct {
 	Document  document.Document
 	Score     float32
 	Embedding []float32
 }
 
+type ChunkResult struct {
+	Chunk document.Chunk
+	Score float32
+}
+
 func (s *Service) FindSimilarDocuments(ctx context.Context, query string, docs []document.Document, limit int) ([]SimilarityResult, error) {
-	queryEmbedding, err := s.GetEmbedding(ctx, query)
+	idx := s.Index()
+
+	queryEmbedding, err := s.createEmbedding(ctx, idx.Model, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get query embedding: %w", err)
 	}
 
-	var results []SimilarityResult
+	return s.rankDocuments(ctx, idx, queryEmbedding, docs, limit)
+}
 
-	for _, doc := range docs {
-		if _, exists := s.cache[doc.ID]; !exists {
-			if err := s.IndexDocument(ctx, doc); err != nil {
-				return nil, err
-			}
-		}
+// FindSimilarByVector ranks docs against a query vector computed elsewhere.
+// The vector must come from the same model as the active index.
+func (s *Service) FindSimilarByVector(ctx context.Context, model string, vector []float32, docs []document.Document, limit int) ([]SimilarityResult, error) {
+	idx := s.Index()
 
-		docEmbedding := s.cache[doc.ID]
-		score := cosineSimilarity(queryEmbedding, docEmbedding)
+	if model != idx.Model {
+		return nil, fmt.Errorf("%w: query uses %s, index uses %s", ErrModelMismatch, model, idx.Model)
+	}
 
-		results = append(results, SimilarityResult{
-			Document:  doc,
-			Score:     score,
-			Embedding: docEmbedding,
-		})
+	return s.rankDocuments(ctx, idx, vector, docs, limit)
+}
+
+func (s *Service) FindSimilarChunks(ctx context.Context, query string, chunks []document.Chunk, limit int) ([]ChunkResult, error) {
+	idx := s.Index()
+
+	queryEmbedding, err := s.createEmbedding(ctx, idx.Model, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query embedding: %w", err)
+	}
+
+	items := make([]item, len(chunks))
+	for i, chunk := range chunks {
+		items[i] = chunkItem(chunk)
+	}
+
+	scores, err := s.score(ctx, idx, queryEmbedding, items)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ChunkResult, len(chunks))
+	for i, chunk := range chunks {
+		results[i] = ChunkResult{Chunk: chunk, Score: scores[i]}
 	}
 
 	sort.Slice(results, func(i, j int) bool {
@@ -92,24 +389,58 @@ func (s *Service) FindSimilarDocuments(ctx context.Context, query string, docs [
 	return results, nil
 }
 
-func cosineSimilarity(a, b []float32) float32 {
-	var dotProduct float32
-	var normA float32
-	var normB float32
+func (s *Service) rankDocuments(ctx context.Context, idx *Index, queryEmbedding []float32, docs []document.Document, limit int) ([]SimilarityResult, error) {
+	if err := s.ensureDocuments(ctx, idx, docs); err != nil {
+		return nil, err
+	}
+
+	items := make([]item, len(docs))
+	for i, doc := range docs {
+		items[i] = documentItem(doc)
+	}
+
+	scores, err := s.score(ctx, idx, queryEmbedding, items)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < len(a); i++ {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
+	results := make([]SimilarityResult, len(docs))
+	for i, doc := range docs {
+		docEmbedding, _ := idx.Get(doc.ID)
+		results[i] = SimilarityResult{
+			Document:  doc,
+			Score:     scores[i],
+			Embedding: docEmbedding,
+		}
 	}
 
-	if normA == 0 || normB == 0 {
-		return 0
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
 	}
 
-	return dotProduct / (sqrt(normA) * sqrt(normB))
+	return results, nil
 }
 
-func sqrt(x float32) float32 {
-	return float32(math.Sqrt(float64(x)))
+// score returns the similarity of every item to the query, in item order,
+// embedding items that are not indexed yet.
+func (s *Service) score(ctx context.Context, idx *Index, queryEmbedding []float32, items []item) ([]float32, error) {
+	if err := s.ensureIndexed(ctx, idx, items); err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(items))
+	for i, it := range items {
+		vector, _ := idx.Get(it.id)
+		score, err := idx.Score(queryEmbedding, vector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to score %s: %w", it.id, err)
+		}
+		scores[i] = score
+	}
+
+	return scores, nil
 }
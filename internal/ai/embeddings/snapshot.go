@@ -0,0 +1,198 @@
+package embeddings
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+const (
+	snapshotFormat  = "vector-index-snapshot"
+	snapshotVersion = 1
+)
+
+// A snapshot is JSON Lines: one SnapshotHeader followed by Count
+// SnapshotRecords, so it can be streamed in both directions and inspected
+// with ordinary text tools.
+type SnapshotHeader struct {
+	Format    string       `json:"format"`
+	Version   int          `json:"version"`
+	Model     string       `json:"model"`
+	Dimension int          `json:"dimension"`
+	Options   IndexOptions `json:"options"`
+	Count     int          `json:"count"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type SnapshotRecord struct {
+	Document  document.Document `json:"document"`
+	Embedding []float32         `json:"embedding"`
+	Chunks    []SnapshotChunk   `json:"chunks,omitempty"`
+}
+
+type SnapshotChunk struct {
+	Chunk     document.Chunk `json:"chunk"`
+	Embedding []float32      `json:"embedding"`
+}
+
+// SnapshotFailure is a snapshot document the repository refused to store.
+type SnapshotFailure struct {
+	DocumentID string `json:"document_id"`
+	Error      string `json:"error"`
+}
+
+// ExportSnapshot writes docs, their chunks and all their vectors from the
+// active index to w, embedding anything that has not been indexed yet.
+func (s *Service) ExportSnapshot(ctx context.Context, w io.Writer, docs []document.Document, chunks []document.Chunk) error {
+	idx := s.Index()
+
+	items := make([]item, 0, len(chunks))
+	chunksByDoc := make(map[string][]document.Chunk)
+	for _, chunk := range chunks {
+		items = append(items, chunkItem(chunk))
+		chunksByDoc[chunk.DocumentID] = append(chunksByDoc[chunk.DocumentID], chunk)
+	}
+
+	if err := s.ensureIndexed(ctx, idx, items); err != nil {
+		return err
+	}
+	if err := s.ensureDocuments(ctx, idx, docs); err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	info := idx.Info()
+	header := SnapshotHeader{
+		Format:    snapshotFormat,
+		Version:   snapshotVersion,
+		Model:     info.Model,
+		Dimension: info.Dimension,
+		Options:   idx.Options(),
+		Count:     len(docs),
+		CreatedAt: time.Now(),
+	}
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+
+	for _, doc := range docs {
+		vector, _ := idx.Get(doc.ID)
+		record := SnapshotRecord{Document: doc, Embedding: vector}
+		for _, chunk := range chunksByDoc[doc.ID] {
+			chunkVector, _ := idx.Get(chunk.ID)
+			record.Chunks = append(record.Chunks, SnapshotChunk{Chunk: chunk, Embedding: chunkVector})
+		}
+
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write snapshot record %s: %w", doc.ID, err)
+		}
+	}
+
+	return buf.Flush()
+}
+
+// ImportSnapshot loads a snapshot into a new index and makes it active once
+// every record has been validated. The documents are returned so the caller
+// can add them to its repository.
+func (s *Service) ImportSnapshot(r io.Reader) (SnapshotHeader, []document.Document, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var header SnapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return header, nil, fmt.Errorf("unknown snapshot format %q", header.Format)
+	}
+	if header.Version != snapshotVersion {
+		return header, nil, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+	if !IsSupportedModel(header.Model) {
+		return header, nil, fmt.Errorf("%w: %s", ErrUnsupportedModel, header.Model)
+	}
+	if _, err := ParseMetric(string(header.Options.Metric)); err != nil {
+		return header, nil, err
+	}
+
+	idx := NewIndex(header.Model, header.Options)
+	if header.Dimension != 0 && header.Dimension != idx.Dimension {
+		return header, nil, fmt.Errorf("%w: snapshot has %d, model %s produces %d", ErrDimensionMismatch, header.Dimension, header.Model, idx.Dimension)
+	}
+
+	if header.Count < 0 {
+		return header, nil, fmt.Errorf("invalid snapshot record count %d", header.Count)
+	}
+
+	// header.Count is not trusted for allocation; the truncation check
+	// below holds the records to it.
+	var docs []document.Document
+	for {
+		var record SnapshotRecord
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return header, nil, fmt.Errorf("failed to read snapshot record %d: %w", len(docs)+1, err)
+		}
+
+		if record.Document.ID == "" {
+			return header, nil, fmt.Errorf("snapshot record %d has no document id", len(docs)+1)
+		}
+		if err := idx.Put(record.Document.ID, record.Document.Content, record.Embedding); err != nil {
+			return header, nil, fmt.Errorf("snapshot record %s: %w", record.Document.ID, err)
+		}
+		for _, c := range record.Chunks {
+			if c.Chunk.DocumentID != record.Document.ID {
+				return header, nil, fmt.Errorf("snapshot record %s contains chunk %s of another document", record.Document.ID, c.Chunk.ID)
+			}
+			if err := idx.Put(c.Chunk.ID, c.Chunk.Content, c.Embedding); err != nil {
+				return header, nil, fmt.Errorf("snapshot chunk %s: %w", c.Chunk.ID, err)
+			}
+		}
+		docs = append(docs, record.Document)
+	}
+
+	if len(docs) != header.Count {
+		return header, nil, fmt.Errorf("snapshot is truncated: header declares %d records, found %d", header.Count, len(docs))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.migration != nil && s.migration.State == MigrationRunning {
+		return header, nil, ErrMigrationInProgress
+	}
+	s.index.Store(idx)
+
+	return header, docs, nil
+}
+
+// AddSnapshotDocuments adds the documents of an imported snapshot to repo
+// and returns how many were stored. A document the repository refuses,
+// for containing PII or failing validation, has its vectors removed from
+// the index again so none are left without a document, and is reported
+// as a failure.
+func (s *Service) AddSnapshotDocuments(repo *document.Repository, docs []document.Document) (int, []SnapshotFailure) {
+	idx := s.Index()
+
+	added := 0
+	var failed []SnapshotFailure
+	for _, doc := range docs {
+		if _, err := repo.Add(doc); err != nil {
+			forget(idx, doc.ID)
+			failed = append(failed, SnapshotFailure{DocumentID: doc.ID, Error: err.Error()})
+			continue
+		}
+		added++
+	}
+	return added, failed
+}
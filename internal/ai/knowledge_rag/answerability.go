@@ -0,0 +1,86 @@
+package knowledge_rag
+
+import (
+	"context"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/rerank"
+)
+
+// noAnswer is what the model is told to reply when the context does not
+// answer the question.
+const noAnswer = "NO_ANSWER"
+
+const unanswerableReply = "Sorry, I couldn't find an answer to that in our help articles. I can pass your question on to our support team."
+
+type UnanswerableReason string
+
+const (
+	// ReasonNoDocuments means retrieval found nothing for the question.
+	ReasonNoDocuments UnanswerableReason = "no_relevant_documents"
+	// ReasonLowConfidence means the best chunk scored below the minimum
+	// confidence, so the model was not asked.
+	ReasonLowConfidence UnanswerableReason = "low_confidence"
+	// ReasonModelDeclined means the model judged that the context does not
+	// answer the question.
+	ReasonModelDeclined UnanswerableReason = "model_declined"
+)
+
+// Unanswerable explains why no answer was given and how to escalate.
+type Unanswerable struct {
+	Reason     UnanswerableReason `json:"reason"`
+	Escalation Escalation         `json:"escalation"`
+}
+
+type Escalation struct {
+	Channel string `json:"channel"`
+	Message string `json:"message"`
+}
+
+func newUnanswerable(reason UnanswerableReason) *Unanswerable {
+	return &Unanswerable{
+		Reason: reason,
+		Escalation: Escalation{
+			Channel: "human_agent",
+			Message: "Offer to hand the conversation to a support agent or open a ticket with the customer's question.",
+		},
+	}
+}
+
+// confidence is how well the best context chunk matches the question, in
+// [0, 1]. Each chunk counts with the better of two signals: its reranker
+// score, or a lexical score when no reranker ran, since retrieval scores
+// such as BM25 or RRF are not comparable across queries; and its cosine
+// similarity rescaled from the similarity floor, so paraphrases with no
+// words in common with the article are not taken for misses.
+func confidence(ctx context.Context, question string, retrieved []retrievedChunk, minSimilarity float64) float64 {
+	lexical := make(map[string]float64)
+	if len(retrieved) > 0 && retrieved[0].rerankScore == nil {
+		candidates := make([]rerank.Candidate, len(retrieved))
+		for i, r := range retrieved {
+			candidates[i] = rerank.Candidate{ID: r.chunk.ID, Title: r.document.Title, Text: r.text}
+		}
+		results, _ := (&rerank.LexicalReranker{}).Rerank(ctx, question, candidates)
+		for _, result := range results {
+			lexical[result.ID] = result.Score
+		}
+	}
+
+	best := 0.0
+	for _, r := range retrieved {
+		score := lexical[r.chunk.ID]
+		if r.rerankScore != nil {
+			score = *r.rerankScore
+		}
+		if r.similarity > minSimilarity && minSimilarity < 1 {
+			score = max(score, min((r.similarity-minSimilarity)/(1-minSimilarity), 1))
+		}
+		best = max(best, score)
+	}
+	return best
+}
+
+// declined reports whether the model replied that it cannot answer.
+func declined(reply string) bool {
+	return strings.HasPrefix(strings.TrimSpace(reply), noAnswer)
+}
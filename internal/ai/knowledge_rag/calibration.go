@@ -0,0 +1,331 @@
+package knowledge_rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/jsonl"
+)
+
+var (
+	ErrUnknownDocument    = errors.New("unknown document")
+	ErrNothingToCalibrate = errors.New("no relevant document could be scored")
+)
+
+// ThresholdSource says where a vector similarity floor came from.
+type ThresholdSource string
+
+const (
+	ThresholdDefault    ThresholdSource = "default"
+	ThresholdCalibrated ThresholdSource = "calibrated"
+	ThresholdRequest    ThresholdSource = "request"
+)
+
+// minCalibrationQuestions keeps a handful of examples from setting the
+// floor for every query.
+const minCalibrationQuestions = 5
+
+// defaultThresholds are cosine similarity floors for each embedding model
+// until it is calibrated. Similarities from ada-002 bunch up high, with
+// unrelated texts often above 0.7, while the text-embedding-3 models spread
+// them out much lower.
+var defaultThresholds = map[string]float64{
+	"text-embedding-ada-002": 0.7,
+	"text-embedding-3-small": 0.3,
+	"text-embedding-3-large": 0.3,
+}
+
+const fallbackThreshold = 0.7
+
+// defaultThreshold converts the model's cosine floor to metric. OpenAI
+// embeddings have unit length, so the dot product equals the cosine and
+// the Euclidean distance is sqrt(2 - 2cos).
+func defaultThreshold(model string, metric embeddings.Metric) float64 {
+	threshold, ok := defaultThresholds[model]
+	if !ok {
+		threshold = fallbackThreshold
+	}
+	if metric == embeddings.MetricEuclidean {
+		return 1 / (1 + math.Sqrt(2-2*threshold))
+	}
+	return threshold
+}
+
+// LabeledQuestion is a question with the documents that answer it; every
+// other document is taken not to.
+type LabeledQuestion struct {
+	Question          string   `json:"question"`
+	RelevantDocuments []string `json:"relevant_documents"`
+}
+
+type CalibrationRequest struct {
+	Questions []LabeledQuestion `json:"questions"`
+}
+
+func (r CalibrationRequest) Validate() error {
+	if len(r.Questions) < minCalibrationQuestions {
+		return fmt.Errorf("at least %d questions are needed", minCalibrationQuestions)
+	}
+	for i, q := range r.Questions {
+		if q.Question == "" {
+			return fmt.Errorf("question %d is empty", i+1)
+		}
+		if len(q.RelevantDocuments) == 0 {
+			return fmt.Errorf("question %d has no relevant documents", i+1)
+		}
+	}
+	return nil
+}
+
+// Calibration is the similarity floor learned for one embedding model and
+// metric, with how well it separated the labelled documents.
+type Calibration struct {
+	Model        string            `json:"model"`
+	Metric       embeddings.Metric `json:"metric"`
+	Threshold    float64           `json:"threshold"`
+	Precision    float64           `json:"precision"`
+	Recall       float64           `json:"recall"`
+	F1           float64           `json:"f1"`
+	Questions    int               `json:"questions"`
+	Pairs        int               `json:"pairs"`
+	CalibratedAt time.Time         `json:"calibrated_at"`
+}
+
+// Threshold is the similarity floor queries are currently retrieved with.
+type Threshold struct {
+	Model         string            `json:"model"`
+	Metric        embeddings.Metric `json:"metric"`
+	MinSimilarity float64           `json:"min_similarity"`
+	Source        ThresholdSource   `json:"source"`
+	Calibrations  []Calibration     `json:"calibrations"`
+}
+
+// Calibrations keeps the learned thresholds by model and metric and, when
+// opened on a file, saves them to it.
+type Calibrations struct {
+	path    string
+	byModel map[string]Calibration
+	mu      sync.RWMutex
+}
+
+func NewCalibrations() *Calibrations {
+	return &Calibrations{byModel: make(map[string]Calibration)}
+}
+
+// OpenCalibrations loads the thresholds saved at path, if any, and saves
+// new ones there.
+func OpenCalibrations(path string) (*Calibrations, error) {
+	c := NewCalibrations()
+	c.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calibrations: %w", err)
+	}
+
+	var calibrations []Calibration
+	if err := json.Unmarshal(data, &calibrations); err != nil {
+		return nil, fmt.Errorf("failed to decode calibrations: %w", err)
+	}
+	for _, cal := range calibrations {
+		c.byModel[calibrationKey(cal.Model, cal.Metric)] = cal
+	}
+	return c, nil
+}
+
+func (c *Calibrations) List() []Calibration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.list()
+}
+
+func (c *Calibrations) list() []Calibration {
+	calibrations := make([]Calibration, 0, len(c.byModel))
+	for _, cal := range c.byModel {
+		calibrations = append(calibrations, cal)
+	}
+	sort.Slice(calibrations, func(i, j int) bool {
+		return calibrationKey(calibrations[i].Model, calibrations[i].Metric) < calibrationKey(calibrations[j].Model, calibrations[j].Metric)
+	})
+	return calibrations
+}
+
+func (c *Calibrations) threshold(model string, metric embeddings.Metric) (float64, ThresholdSource) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if cal, ok := c.byModel[calibrationKey(model, metric)]; ok {
+		return cal.Threshold, ThresholdCalibrated
+	}
+	return defaultThreshold(model, metric), ThresholdDefault
+}
+
+// put stores cal, replacing the earlier calibration of its model and
+// metric, and saves the file. The file is replaced whole and synced so a
+// crash leaves either the old or the new calibrations.
+func (c *Calibrations) put(cal Calibration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byModel[calibrationKey(cal.Model, cal.Metric)] = cal
+
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode calibrations: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create calibration directory: %w", err)
+	}
+	if err := jsonl.WriteFile(c.path, data); err != nil {
+		return fmt.Errorf("failed to write calibrations: %w", err)
+	}
+	return nil
+}
+
+func calibrationKey(model string, metric embeddings.Metric) string {
+	return model + "/" + string(metric)
+}
+
+// labeledScore is a document's best chunk similarity for a question and
+// whether the document answers it.
+type labeledScore struct {
+	score    float64
+	relevant bool
+}
+
+// Calibrate learns the similarity floor for the active embedding index
+// from labelled questions. Each question is scored against every document
+// by its best matching chunk, as retrieval would find it, and the floor
+// that best separates the relevant documents from the rest, by F1, is
+// kept for the index's model and metric.
+func (s *Service) Calibrate(ctx context.Context, req CalibrationRequest) (Calibration, error) {
+	docs := s.docRepo.List()
+	known := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		known[doc.ID] = true
+	}
+	for _, q := range req.Questions {
+		for _, id := range q.RelevantDocuments {
+			if !known[id] {
+				return Calibration{}, fmt.Errorf("%w: %s", ErrUnknownDocument, id)
+			}
+		}
+	}
+
+	idx := s.embeddingService.Index()
+	chunks := s.chunkStore.ChunksFor(docs)
+
+	var pairs []labeledScore
+	for _, q := range req.Questions {
+		results, err := s.embeddingService.FindSimilarChunks(ctx, q.Question, chunks, 0)
+		if err != nil {
+			return Calibration{}, fmt.Errorf("failed to score question: %w", err)
+		}
+
+		relevant := make(map[string]bool, len(q.RelevantDocuments))
+		for _, id := range q.RelevantDocuments {
+			relevant[id] = true
+		}
+		// Results come best first, so a document's first chunk is its best.
+		seen := make(map[string]bool)
+		for _, result := range results {
+			if seen[result.Chunk.DocumentID] {
+				continue
+			}
+			seen[result.Chunk.DocumentID] = true
+			pairs = append(pairs, labeledScore{score: float64(result.Score), relevant: relevant[result.Chunk.DocumentID]})
+		}
+	}
+
+	cal, err := bestThreshold(pairs)
+	if err != nil {
+		return Calibration{}, err
+	}
+	cal.Model = idx.Model
+	cal.Metric = idx.Metric
+	cal.Questions = len(req.Questions)
+	cal.CalibratedAt = time.Now()
+
+	if err := s.calibrations.put(cal); err != nil {
+		return Calibration{}, err
+	}
+	return cal, nil
+}
+
+// bestThreshold sweeps the scores from the top and returns the threshold
+// with the highest F1, placed halfway to the next lower score so that it
+// does not sit right on a labelled example. Ties go to the higher
+// threshold.
+func bestThreshold(pairs []labeledScore) (Calibration, error) {
+	relevant := 0
+	for _, p := range pairs {
+		if p.relevant {
+			relevant++
+		}
+	}
+	if relevant == 0 {
+		return Calibration{}, ErrNothingToCalibrate
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].score > pairs[j].score })
+
+	best := Calibration{Pairs: len(pairs)}
+	tp, fp := 0, 0
+	for i, p := range pairs {
+		if p.relevant {
+			tp++
+		} else {
+			fp++
+		}
+		// Every score equal to this one passes the same threshold.
+		if i+1 < len(pairs) && pairs[i+1].score == p.score {
+			continue
+		}
+		if tp == 0 {
+			continue
+		}
+
+		precision := float64(tp) / float64(tp+fp)
+		recall := float64(tp) / float64(relevant)
+		f1 := 2 * precision * recall / (precision + recall)
+		if f1 > best.F1 {
+			best.Threshold = p.score
+			if i+1 < len(pairs) {
+				best.Threshold = (p.score + pairs[i+1].score) / 2
+			}
+			best.Precision, best.Recall, best.F1 = precision, recall, f1
+		}
+	}
+	return best, nil
+}
+
+// UseCalibrations replaces the in-memory calibrations, e.g. with ones kept
+// in a file.
+func (s *Service) UseCalibrations(calibrations *Calibrations) {
+	s.calibrations = calibrations
+}
+
+// Threshold reports the similarity floor for the active embedding index
+// and every calibration learned so far.
+func (s *Service) Threshold() Threshold {
+	idx := s.embeddingService.Index()
+	t := Threshold{Model: idx.Model, Metric: idx.Metric, Calibrations: s.calibrations.List()}
+	t.MinSimilarity, t.Source = s.calibrations.threshold(idx.Model, idx.Metric)
+	return t
+}
@@ -0,0 +1,187 @@
+package knowledge_rag
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
+)
+
+// citationMarker matches [1] and [1, 3]; adjacent markers such as [1][3]
+// match one at a time.
+var citationMarker = regexp.MustCompile(`\s*\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// sentenceBoundary ends a sentence after its punctuation and any citation
+// markers the model put after the full stop.
+var sentenceBoundary = regexp.MustCompile(`[.!?]+["')]*(?:\s*\[\d+(?:\s*,\s*\d+)*\])*\s+`)
+
+// CitedSentence is one sentence of the reply, without its markers, and the
+// passages it cites.
+type CitedSentence struct {
+	Text      string     `json:"text"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Citation resolves a marker to the chunk it numbers in the context. Quote
+// is the sentence of the chunk that best supports the reply sentence, at
+// Start:End in the chunk content. Supported is false when the chunk shares
+// no terms with the sentence, which usually means a misattributed marker.
+type Citation struct {
+	Marker     int    `json:"marker"`
+	DocumentID string `json:"document_id"`
+	ChunkID    string `json:"chunk_id"`
+	Version    int    `json:"version"`
+	Quote      string `json:"quote,omitempty"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Supported  bool   `json:"supported"`
+}
+
+// citedReply is the parsed reply: the text with markers that do not number
+// a context chunk removed, its sentences, and the rejected marker numbers.
+type citedReply struct {
+	text      string
+	sentences []CitedSentence
+	invalid   []int
+	cited     []retrievedChunk
+}
+
+func parseCitations(reply string, retrieved []retrievedChunk) citedReply {
+	var parsed citedReply
+
+	// Drop markers that point outside the context before splitting, so
+	// the returned reply only carries citations that resolve.
+	parsed.text = citationMarker.ReplaceAllStringFunc(reply, func(marker string) string {
+		var valid []string
+		for _, n := range markerNumbers(marker) {
+			if n < 1 || n > len(retrieved) {
+				if !slices.Contains(parsed.invalid, n) {
+					parsed.invalid = append(parsed.invalid, n)
+				}
+				continue
+			}
+			valid = append(valid, strconv.Itoa(n))
+		}
+		if len(valid) == 0 {
+			return ""
+		}
+		prefix := marker[:len(marker)-len(strings.TrimLeft(marker, " \t\n"))]
+		return prefix + "[" + strings.Join(valid, ", ") + "]"
+	})
+
+	citedChunks := make(map[int]bool)
+	for _, span := range sentenceSpans(parsed.text) {
+		sentence := parsed.text[span[0]:span[1]]
+
+		var markers []int
+		for _, marker := range citationMarker.FindAllString(sentence, -1) {
+			for _, n := range markerNumbers(marker) {
+				if !slices.Contains(markers, n) {
+					markers = append(markers, n)
+				}
+			}
+		}
+
+		text := strings.TrimSpace(citationMarker.ReplaceAllString(sentence, ""))
+		if text == "" {
+			continue
+		}
+
+		cited := CitedSentence{Text: text}
+		for _, n := range markers {
+			r := retrieved[n-1]
+			citation := Citation{
+				Marker:     n,
+				DocumentID: r.document.ID,
+				ChunkID:    r.chunk.ID,
+				Version:    r.document.Version,
+			}
+			if start, end, ok := bestQuote(text, r.chunk.Content); ok {
+				citation.Quote = r.chunk.Content[start:end]
+				citation.Start, citation.End = start, end
+				citation.Supported = true
+			}
+			cited.Citations = append(cited.Citations, citation)
+
+			if !citedChunks[n] {
+				citedChunks[n] = true
+				parsed.cited = append(parsed.cited, r)
+			}
+		}
+		parsed.sentences = append(parsed.sentences, cited)
+	}
+
+	return parsed
+}
+
+func markerNumbers(marker string) []int {
+	inner := strings.Trim(strings.TrimSpace(marker), "[]")
+	var numbers []int
+	for _, part := range strings.Split(inner, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// sentenceSpans returns the byte ranges of the sentences in text, each
+// including any trailing citation markers.
+func sentenceSpans(text string) [][2]int {
+	var spans [][2]int
+	last := 0
+	for _, loc := range sentenceBoundary.FindAllStringIndex(text+" ", -1) {
+		end := min(loc[1], len(text))
+		if strings.TrimSpace(text[last:end]) != "" {
+			spans = append(spans, trimSpan(text, last, end))
+		}
+		last = end
+	}
+	if strings.TrimSpace(text[last:]) != "" {
+		spans = append(spans, trimSpan(text, last, len(text)))
+	}
+	return spans
+}
+
+func trimSpan(text string, start, end int) [2]int {
+	for start < end && isSpace(text[start]) {
+		start++
+	}
+	for end > start && isSpace(text[end-1]) {
+		end--
+	}
+	return [2]int{start, end}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// bestQuote finds the sentence of content sharing the largest share of the
+// claim's terms.
+func bestQuote(claim, content string) (start, end int, ok bool) {
+	terms := make(map[string]bool)
+	for _, term := range search.Terms(claim) {
+		terms[term] = true
+	}
+	if len(terms) == 0 {
+		return 0, 0, false
+	}
+
+	best := 0
+	for _, span := range sentenceSpans(content) {
+		overlap := make(map[string]bool)
+		for _, term := range search.Terms(content[span[0]:span[1]]) {
+			if terms[term] {
+				overlap[term] = true
+			}
+		}
+		if len(overlap) > best {
+			best = len(overlap)
+			start, end = span[0], span[1]
+		}
+	}
+	return start, end, best > 0
+}
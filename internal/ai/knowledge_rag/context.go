@@ -0,0 +1,213 @@
+package knowledge_rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tokens"
+)
+
+const (
+	// shingleSize is the word n-gram length used to spot chunks whose text
+	// is already in the context.
+	shingleSize = 5
+
+	// maxCovered drops a chunk when this share of its shingles is already
+	// in the context, as with a chunk nested in the overlap of two others.
+	maxCovered = 0.8
+
+	// minOverlapWords keeps a word or two that merely happen to repeat
+	// across a chunk boundary from being trimmed.
+	minOverlapWords = 3
+
+	// messageOverhead approximates the tokens the chat format adds around
+	// each message.
+	messageOverhead = 4
+)
+
+// assembleContext picks up to maxChunks chunks that go into the prompt
+// from retrieved, best first, within budget tokens. It skips chunks whose text is already
+// covered, trims the overlap between neighbouring chunks of a document,
+// and orders the result so the strongest chunks sit at the start and end
+// of the context, where models attend to them best. It returns the chunks
+// in prompt order and the tokens they use, and records why the others were
+// left out in skipped.
+func assembleContext(retrieved []retrievedChunk, counter *tokens.Counter, budget, maxChunks int, skipped map[string]Decision) ([]retrievedChunk, int) {
+	var selected []retrievedChunk
+	covered := make(map[string]bool)
+	used := 0
+
+	for _, r := range retrieved {
+		if len(selected) == maxChunks {
+			skipped[r.chunk.ID] = DecisionOverLimit
+			continue
+		}
+
+		r.text = trimOverlap(r, selected)
+		shingles := shinglesOf(r.text)
+		if len(shingles) == 0 || coveredShare(shingles, covered) >= maxCovered {
+			skipped[r.chunk.ID] = DecisionCovered
+			continue
+		}
+
+		cost := counter.Count(formatEntry(len(selected)+1, r))
+		if used+cost > budget {
+			// A first chunk too long for the budget is cut to fit rather
+			// than answering without context; later ones are skipped in
+			// favour of shorter chunks further down.
+			if len(selected) > 0 {
+				skipped[r.chunk.ID] = DecisionOverBudget
+				continue
+			}
+			// Tokens can merge across the cut, so shrink until it fits.
+			for excess := cost - budget; excess > 0 && r.text != ""; excess = cost - budget {
+				r.text = counter.Truncate(r.text, counter.Count(r.text)-excess)
+				cost = counter.Count(formatEntry(1, r))
+			}
+			if r.text == "" {
+				skipped[r.chunk.ID] = DecisionOverBudget
+				continue
+			}
+		}
+
+		selected = append(selected, r)
+		used += cost
+		for _, shingle := range shingles {
+			covered[shingle] = true
+		}
+	}
+
+	return edgeOrder(selected), used
+}
+
+// edgeOrder places ranked items alternately at the front and the back, so
+// the first and second best end up first and last and the weakest in the
+// middle.
+func edgeOrder(ranked []retrievedChunk) []retrievedChunk {
+	ordered := make([]retrievedChunk, len(ranked))
+	front, back := 0, len(ranked)-1
+	for i, r := range ranked {
+		if i%2 == 0 {
+			ordered[front] = r
+			front++
+		} else {
+			ordered[back] = r
+			back--
+		}
+	}
+	return ordered
+}
+
+// trimOverlap removes from the chunk's text the words it repeats from a
+// neighbouring chunk of the same document already in the context; chunkers
+// repeat them at the boundaries so sentences are not cut in half.
+func trimOverlap(r retrievedChunk, selected []retrievedChunk) string {
+	text := r.chunk.Content
+	for _, s := range selected {
+		if s.document.ID != r.document.ID {
+			continue
+		}
+		switch s.chunk.Index {
+		case r.chunk.Index - 1:
+			text = trimLeading(s.text, text)
+		case r.chunk.Index + 1:
+			text = trimTrailing(text, s.text)
+		}
+	}
+	return text
+}
+
+// trimLeading drops the longest run of words that starts text and ends
+// previous.
+func trimLeading(previous, text string) string {
+	prev := strings.Fields(previous)
+	spans := wordSpans(text)
+	for n := min(len(prev), len(spans)); n >= minOverlapWords; n-- {
+		if wordsEqual(prev[len(prev)-n:], text, spans[:n]) {
+			if n == len(spans) {
+				return ""
+			}
+			return text[spans[n][0]:]
+		}
+	}
+	return text
+}
+
+// trimTrailing drops the longest run of words that ends text and starts
+// next.
+func trimTrailing(text, next string) string {
+	following := strings.Fields(next)
+	spans := wordSpans(text)
+	for n := min(len(following), len(spans)); n >= minOverlapWords; n-- {
+		if wordsEqual(following[:n], text, spans[len(spans)-n:]) {
+			if n == len(spans) {
+				return ""
+			}
+			return text[:spans[len(spans)-n-1][1]]
+		}
+	}
+	return text
+}
+
+func wordsEqual(words []string, text string, spans [][2]int) bool {
+	for i, span := range spans {
+		if text[span[0]:span[1]] != words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+func shinglesOf(text string) []string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) < shingleSize {
+		return []string{strings.Join(words, " ")}
+	}
+
+	shingles := make([]string, 0, len(words)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+shingleSize], " "))
+	}
+	return shingles
+}
+
+func coveredShare(shingles []string, covered map[string]bool) float64 {
+	n := 0
+	for _, shingle := range shingles {
+		if covered[shingle] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(shingles))
+}
+
+func formatEntry(n int, r retrievedChunk) string {
+	title := r.document.Title
+	if r.chunk.Heading != "" && r.chunk.Heading != title {
+		title += " - " + r.chunk.Heading
+	}
+	return fmt.Sprintf("[%d] %s\n%s\n\n", n, title, r.text)
+}
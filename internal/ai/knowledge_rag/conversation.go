@@ -0,0 +1,202 @@
+package knowledge_rag
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxTurns bounds a stored conversation; older turns are dropped.
+	maxTurns = 20
+
+	// historyTurns is how many recent turns are used to condense a
+	// follow-up and shown to the model when answering it.
+	historyTurns = 4
+
+	// conversationTTL is how long an idle conversation is kept.
+	conversationTTL = 24 * time.Hour
+)
+
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Turn is one question and answer in a conversation. Standalone is the
+// question retrieval searched for, which differs from Question when a
+// follow-up was condensed with the history.
+type Turn struct {
+	Question   string    `json:"question"`
+	Standalone string    `json:"standalone,omitempty"`
+	Reply      string    `json:"reply"`
+	Sources    []string  `json:"sources,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+type Conversation struct {
+	ID string `json:"id"`
+	// Owner identifies the caller that started the conversation, see
+	// conversationOwner.
+	Owner     string    `json:"-"`
+	Turns     []Turn    `json:"turns"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationStore keeps conversations in memory, forgetting those idle
+// for longer than a day.
+type ConversationStore struct {
+	conversations map[string]*Conversation
+	mu            sync.RWMutex
+}
+
+func NewConversationStore() *ConversationStore {
+	return &ConversationStore{
+		conversations: make(map[string]*Conversation),
+	}
+}
+
+// Get returns a copy of the conversation. Another caller's conversation is
+// reported as not found, so its existence is not revealed either.
+func (s *ConversationStore) Get(id, owner string) (Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conversation, exists := s.conversations[id]
+	if !exists || owner == "" || conversation.Owner != owner || time.Since(conversation.UpdatedAt) > conversationTTL {
+		return Conversation{}, ErrConversationNotFound
+	}
+
+	copied := *conversation
+	copied.Turns = append([]Turn(nil), conversation.Turns...)
+	return copied, nil
+}
+
+// Append adds a turn, starting the conversation for owner if it does not
+// exist yet. Callers only start conversations under IDs the server issued.
+func (s *ConversationStore) Append(id, owner string, turn Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(turn.At)
+
+	conversation, exists := s.conversations[id]
+	if !exists {
+		conversation = &Conversation{ID: id, Owner: owner, CreatedAt: turn.At}
+		s.conversations[id] = conversation
+	}
+
+	conversation.Turns = append(conversation.Turns, turn)
+	if len(conversation.Turns) > maxTurns {
+		conversation.Turns = conversation.Turns[len(conversation.Turns)-maxTurns:]
+	}
+	conversation.UpdatedAt = turn.At
+}
+
+func (s *ConversationStore) Delete(id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conversation, exists := s.conversations[id]; !exists || owner == "" || conversation.Owner != owner {
+		return ErrConversationNotFound
+	}
+	delete(s.conversations, id)
+	return nil
+}
+
+func (s *ConversationStore) prune(now time.Time) {
+	for id, conversation := range s.conversations {
+		if now.Sub(conversation.UpdatedAt) > conversationTTL {
+			delete(s.conversations, id)
+		}
+	}
+}
+
+func newConversationID() string {
+	return uuid.New().String()
+}
+
+// newConversationToken returns the secret an anonymous caller proves a
+// conversation is theirs with.
+func newConversationToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate conversation token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// conversationOwner is who a conversation belongs to: the caller's API key
+// ID, or for a caller without a key the token issued with the conversation,
+// so anonymous callers do not all share one owner. Only a hash of the token
+// is kept. It returns "" when there is neither, which owns nothing.
+func conversationOwner(callerID, token string) string {
+	if callerID != "" {
+		return callerID
+	}
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])
+}
+
+// recentTurns returns the turns a follow-up is read against.
+func recentTurns(turns []Turn) []Turn {
+	if len(turns) > historyTurns {
+		return turns[len(turns)-historyTurns:]
+	}
+	return turns
+}
+
+// condense rewrites a follow-up such as "what about international?" into a
+// question that can be searched on its own. Without history, or if the
+// model call fails, the message is used as is.
+func (s *Service) condense(ctx context.Context, message string, history []Turn) string {
+	if len(history) == 0 {
+		return message
+	}
+
+	var b strings.Builder
+	for _, turn := range history {
+		fmt.Fprintf(&b, "Customer: %s\nAssistant: %s\n", turn.Question, citationMarker.ReplaceAllString(turn.Reply, ""))
+	}
+
+	var out struct {
+		Question string `json:"question"`
+	}
+	err := s.completeJSON(ctx,
+		"You rewrite follow-up messages in a customer support chat as standalone questions. Reply with JSON only.",
+		fmt.Sprintf("Conversation:\n%s\nFollow-up: %s\n\nRewrite the follow-up as a single question that makes sense without the conversation, filling in what it refers to. If it already stands alone, return it unchanged. Reply with JSON {\"question\": \"...\"}.", b.String(), message),
+		100, &out)
+	if err != nil {
+		log.Printf("Failed to condense follow-up, searching with it as is: %v", err)
+		return message
+	}
+
+	if question := strings.TrimSpace(out.Question); question != "" {
+		return question
+	}
+	return message
+}
+
+// historyMessages replays recent turns so the answer can refer back to
+// them.
+func historyMessages(history []Turn) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, 2*len(history))
+	for _, turn := range history {
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: turn.Question},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: citationMarker.ReplaceAllString(turn.Reply, "")},
+		)
+	}
+	return messages
+}
@@ -0,0 +1,160 @@
+package knowledge_rag
+
+import "fmt"
+
+// Cutoff decides how many of the ranked candidates are relevant enough to
+// be put into the context, as opposed to a fixed number of them.
+type Cutoff string
+
+const (
+	// CutoffFixed keeps candidates up to the chunk limit whatever their
+	// scores.
+	CutoffFixed Cutoff = "fixed"
+	// CutoffRelative keeps candidates scoring at least a ratio of the best
+	// candidate's score.
+	CutoffRelative Cutoff = "relative"
+	// CutoffGap cuts the ranking at its largest drop in score, when that
+	// drop is steep enough to separate matches from the rest.
+	CutoffGap Cutoff = "gap"
+)
+
+const (
+	// maxChunksLimit bounds a request's max_chunks.
+	maxChunksLimit = 20
+
+	// minGapShare is the drop between neighbouring scores, as a share of
+	// the best score, that the gap cutoff takes for the end of the matches.
+	minGapShare = 0.15
+)
+
+// CutoffResult reports the cutoffs a request was retrieved with.
+type CutoffResult struct {
+	Strategy Cutoff `json:"strategy"`
+	// Ratio is the share of the best score a candidate needs under the
+	// relative cutoff.
+	Ratio float64 `json:"ratio,omitempty"`
+	// MinSimilarity is the vector similarity below which chunks are not
+	// retrieved at all, and ThresholdSource says where it came from.
+	MinSimilarity   float64         `json:"min_similarity"`
+	ThresholdSource ThresholdSource `json:"threshold_source"`
+	MaxChunks       int             `json:"max_chunks"`
+	// Score names the score the ranking was cut on: rerank or retrieval,
+	// or rrf when the relative and gap cutoffs were skipped because the
+	// retrieval scores were fused from ranks.
+	Score string `json:"score,omitempty"`
+	// Kept counts the candidates that passed the cutoff; context assembly
+	// may still leave some of them out.
+	Kept int `json:"kept"`
+}
+
+func validateCutoff(r Request) error {
+	switch r.Cutoff {
+	case "", CutoffFixed, CutoffRelative, CutoffGap:
+	default:
+		return fmt.Errorf("cutoff must be fixed, relative or gap")
+	}
+
+	if r.CutoffRatio != nil && (*r.CutoffRatio <= 0 || *r.CutoffRatio > 1) {
+		return fmt.Errorf("cutoff_ratio must be in (0, 1]")
+	}
+	if r.MaxChunks != nil && (*r.MaxChunks < 1 || *r.MaxChunks > maxChunksLimit) {
+		return fmt.Errorf("max_chunks must be between 1 and %d", maxChunksLimit)
+	}
+	if r.MinSimilarity != nil && (*r.MinSimilarity < 0 || *r.MinSimilarity > 1) {
+		return fmt.Errorf("min_similarity must be between 0 and 1")
+	}
+	return nil
+}
+
+// cutoff resolves the request's overrides against the configured cutoff
+// and the similarity floor for the active embedding index.
+func (s *Service) cutoff(req Request) CutoffResult {
+	c := CutoffResult{Strategy: s.cutoffStrategy, Ratio: s.cutoffRatio, MaxChunks: s.maxChunks}
+	if req.Cutoff != "" {
+		c.Strategy = req.Cutoff
+	}
+	if req.CutoffRatio != nil {
+		c.Ratio = *req.CutoffRatio
+	}
+	if c.Strategy != CutoffRelative {
+		c.Ratio = 0
+	}
+	if req.MaxChunks != nil {
+		c.MaxChunks = *req.MaxChunks
+	}
+
+	idx := s.embeddingService.Index()
+	c.MinSimilarity, c.ThresholdSource = s.calibrations.threshold(idx.Model, idx.Metric)
+	if req.MinSimilarity != nil {
+		c.MinSimilarity, c.ThresholdSource = *req.MinSimilarity, ThresholdRequest
+	}
+	return c
+}
+
+// applyCutoff keeps the leading candidates that pass c's strategy and
+// marks the rest in skipped. ranked must be ordered best first. The cut is
+// made on rerank scores when the candidates were reranked and on retrieval
+// scores otherwise. Retrieval scores fused by RRF only encode rank: the
+// best candidate always scores about the same and the drops between
+// neighbours are fixed by their positions, so a relative or gap cut on
+// them would keep the same number of candidates for every query. Those
+// cutoffs are skipped then, leaving max_chunks and the token budget.
+func applyCutoff(ranked []retrievedChunk, c *CutoffResult, skipped map[string]Decision) []retrievedChunk {
+	if len(ranked) == 0 {
+		return ranked
+	}
+
+	scores := make([]float64, len(ranked))
+	c.Score = "retrieval"
+	for i, r := range ranked {
+		scores[i] = r.score
+		if r.rerankScore != nil {
+			scores[i] = *r.rerankScore
+			c.Score = "rerank"
+		}
+	}
+
+	if c.Score == "retrieval" && ranked[0].rankFused && c.Strategy != CutoffFixed {
+		c.Score = "rrf"
+		c.Kept = len(ranked)
+		return ranked
+	}
+
+	c.Kept = cutoffLength(scores, *c)
+	for _, r := range ranked[c.Kept:] {
+		skipped[r.chunk.ID] = DecisionBelowCutoff
+	}
+	return ranked[:c.Kept]
+}
+
+// cutoffLength is how many of the descending scores pass the cutoff. The
+// best candidate always does, so a question is never left without context
+// by the cutoff alone; the answerability check judges that.
+func cutoffLength(scores []float64, c CutoffResult) int {
+	if len(scores) == 0 || scores[0] <= 0 {
+		return len(scores)
+	}
+
+	switch c.Strategy {
+	case CutoffRelative:
+		for i, score := range scores {
+			if score < c.Ratio*scores[0] {
+				return i
+			}
+		}
+	case CutoffGap:
+		// Only a drop among the candidates that could make the context
+		// matters; one further down would not change it.
+		n := min(len(scores), c.MaxChunks+1)
+		cut, drop := n, 0.0
+		for i := 1; i < n; i++ {
+			if d := scores[i-1] - scores[i]; d > drop {
+				cut, drop = i, d
+			}
+		}
+		if drop >= minGapShare*scores[0] {
+			return cut
+		}
+	}
+	return len(scores)
+}
@@ -0,0 +1,236 @@
+package knowledge_rag
+
+import (
+	"context"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tokens"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// explainExcluded caps the hidden documents an explanation lists.
+const explainExcluded = 10
+
+// Decision says what became of a retrieval candidate.
+type Decision string
+
+const (
+	DecisionContext     Decision = "context"
+	DecisionDuplicate   Decision = "duplicate"
+	DecisionBelowCutoff Decision = "below_cutoff"
+	DecisionCovered     Decision = "covered"
+	DecisionOverBudget  Decision = "over_budget"
+	DecisionOverLimit   Decision = "over_limit"
+)
+
+// Exclusion says why a document was not searched for this request.
+type Exclusion string
+
+const (
+	ExclusionDraft       Exclusion = "draft"
+	ExclusionNotYetValid Exclusion = "not_yet_valid"
+	ExclusionExpired     Exclusion = "expired"
+	ExclusionAudience    Exclusion = "audience"
+	ExclusionFilter      Exclusion = "filter"
+)
+
+type ExplainRequest struct {
+	Request
+	// Generate also asks the model and includes its answer; otherwise the
+	// explanation stops at the prompt.
+	Generate bool `json:"generate"`
+	// AsAudience explains the request as a reader of that audience would
+	// see it, instead of with the admin caller's own access.
+	AsAudience string `json:"as_audience,omitempty"`
+}
+
+type Explanation struct {
+	Question           string       `json:"question"`
+	StandaloneQuestion string       `json:"standalone_question,omitempty"`
+	Mode               Mode         `json:"mode"`
+	Fusion             Fusion       `json:"fusion,omitempty"`
+	Reranker           string       `json:"reranker,omitempty"`
+	Queries            Queries      `json:"queries"`
+	Cutoff             CutoffResult `json:"cutoff"`
+	// Candidates lists every chunk retrieved, in reranked order.
+	Candidates []CandidateExplanation `json:"candidates"`
+	// Excluded lists documents matching the question by keyword that the
+	// request's audience, validity window or filter kept out of retrieval.
+	Excluded     []ExcludedDocument `json:"excluded,omitempty"`
+	Prompt       []PromptMessage    `json:"prompt"`
+	Tokens       TokenUsage         `json:"tokens"`
+	Confidence   float64            `json:"confidence"`
+	Unanswerable *Unanswerable      `json:"unanswerable,omitempty"`
+	Answer       *Response          `json:"answer,omitempty"`
+}
+
+type CandidateExplanation struct {
+	Rank           int      `json:"rank"`
+	ChunkID        string   `json:"chunk_id"`
+	DocumentID     string   `json:"document_id"`
+	Title          string   `json:"title"`
+	Heading        string   `json:"heading,omitempty"`
+	RetrievalScore float64  `json:"retrieval_score"`
+	KeywordScore   float64  `json:"keyword_score"`
+	VectorScore    float64  `json:"vector_score"`
+	RerankScore    *float64 `json:"rerank_score,omitempty"`
+	Decision       Decision `json:"decision"`
+	// ContextPosition is the chunk's [n] in the prompt.
+	ContextPosition int `json:"context_position,omitempty"`
+}
+
+type ExcludedDocument struct {
+	DocumentID   string    `json:"document_id"`
+	Title        string    `json:"title"`
+	KeywordScore float64   `json:"keyword_score"`
+	Reason       Exclusion `json:"reason"`
+}
+
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	Tokens  int    `json:"tokens"`
+}
+
+type TokenUsage struct {
+	Prompt        int `json:"prompt"`
+	Context       int `json:"context"`
+	ContextBudget int `json:"context_budget"`
+	ReplyMax      int `json:"reply_max"`
+	ContextWindow int `json:"context_window"`
+}
+
+// Explain runs a request through the pipeline and reports each step. It
+// neither stores a conversation turn nor logs the query, so debugging does
+// not skew the knowledge gap report.
+func (s *Service) Explain(ctx context.Context, req ExplainRequest) (*Explanation, error) {
+	p, err := s.prepare(ctx, req.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &Explanation{
+		Question:     req.Message,
+		Mode:         req.mode(),
+		Queries:      p.queries,
+		Cutoff:       p.cutoff,
+		Candidates:   make([]CandidateExplanation, len(p.candidates)),
+		Excluded:     s.excludedDocuments(req.Request, p.question),
+		Confidence:   p.confidence,
+		Unanswerable: p.unanswerable,
+		Tokens: TokenUsage{
+			Context:       p.contextTokens,
+			ContextBudget: p.budget,
+			ReplyMax:      s.replyTokens,
+			ContextWindow: tokens.ContextWindow(chatModel),
+		},
+	}
+	if p.question != req.Message {
+		exp.StandaloneQuestion = p.question
+	}
+	if exp.Mode == ModeHybrid {
+		exp.Fusion = req.Fusion
+		if exp.Fusion == "" {
+			exp.Fusion = FusionRRF
+		}
+	}
+	if p.reranker != nil {
+		exp.Reranker = p.reranker.Name()
+	}
+
+	positions := make(map[string]int, len(p.context))
+	for i, r := range p.context {
+		positions[r.chunk.ID] = i + 1
+	}
+	for i, r := range p.candidates {
+		decision := p.skipped[r.chunk.ID]
+		if positions[r.chunk.ID] > 0 {
+			decision = DecisionContext
+		}
+		exp.Candidates[i] = CandidateExplanation{
+			Rank:            i + 1,
+			ChunkID:         r.chunk.ID,
+			DocumentID:      r.document.ID,
+			Title:           r.document.Title,
+			Heading:         r.chunk.Heading,
+			RetrievalScore:  r.score,
+			KeywordScore:    r.keywordScore,
+			VectorScore:     r.similarity,
+			RerankScore:     r.rerankScore,
+			Decision:        decision,
+			ContextPosition: positions[r.chunk.ID],
+		}
+	}
+
+	for _, message := range p.messages {
+		n := s.tokens.Count(message.Content)
+		exp.Prompt = append(exp.Prompt, PromptMessage{Role: message.Role, Content: message.Content, Tokens: n})
+		exp.Tokens.Prompt += n + messageOverhead
+	}
+
+	if req.Generate {
+		if exp.Answer, err = s.answer(ctx, req.Request, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return exp, nil
+}
+
+// excludedDocuments finds the documents that best match the question by
+// keyword among those the request could not see, so a missing article can
+// be told apart from a hidden one.
+func (s *Service) excludedDocuments(req Request, question string) []ExcludedDocument {
+	visibility := document.Visibility{Audience: req.Audience, At: time.Now()}
+
+	var hidden []document.Document
+	for _, doc := range s.docRepo.List() {
+		if exclusionReason(doc, req.Filter, visibility) != "" {
+			hidden = append(hidden, doc)
+		}
+	}
+	if len(hidden) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]document.Document, len(hidden))
+	for _, doc := range hidden {
+		byID[doc.ID] = doc
+	}
+
+	var excluded []ExcludedDocument
+	seen := make(map[string]bool)
+	for _, result := range s.chunkStore.Search(question, hidden, explainExcluded*s.maxChunks) {
+		doc := byID[result.Chunk.DocumentID]
+		if seen[doc.ID] {
+			continue
+		}
+		seen[doc.ID] = true
+		excluded = append(excluded, ExcludedDocument{
+			DocumentID:   doc.ID,
+			Title:        doc.Title,
+			KeywordScore: result.Score,
+			Reason:       exclusionReason(doc, req.Filter, visibility),
+		})
+		if len(excluded) == explainExcluded {
+			break
+		}
+	}
+	return excluded
+}
+
+func exclusionReason(doc document.Document, filter *document.Filter, visibility document.Visibility) Exclusion {
+	switch {
+	case doc.Status == document.StatusDraft:
+		return ExclusionDraft
+	case doc.ValidFrom != nil && visibility.At.Before(*doc.ValidFrom):
+		return ExclusionNotYetValid
+	case doc.ValidUntil != nil && !visibility.At.Before(*doc.ValidUntil):
+		return ExclusionExpired
+	case !visibility.Allows(doc):
+		return ExclusionAudience
+	case !filter.Matches(doc):
+		return ExclusionFilter
+	}
+	return ""
+}
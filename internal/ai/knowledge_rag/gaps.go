@@ -0,0 +1,244 @@
+package knowledge_rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+)
+
+const (
+	// gapExamples is how many example questions a topic lists.
+	gapExamples = 5
+
+	// gapEmbedBatch caps the questions embedded in one request.
+	gapEmbedBatch = 100
+)
+
+// GapOptions selects the queries to analyse and how tightly to group them.
+type GapOptions struct {
+	// Since ignores older queries when set.
+	Since time.Time
+	// MaxConfidence is the confidence below which an answered query still
+	// counts as low-confidence; unanswerable queries always count.
+	MaxConfidence float64
+	// MinSimilarity is the cosine similarity a question needs to a topic
+	// to join it.
+	MinSimilarity float64
+	// Limit caps the topics reported.
+	Limit int
+}
+
+func DefaultGapOptions() GapOptions {
+	return GapOptions{MaxConfidence: 0.5, MinSimilarity: 0.85, Limit: 10}
+}
+
+func (o GapOptions) Validate() error {
+	if o.MaxConfidence < 0 || o.MaxConfidence > 1 {
+		return fmt.Errorf("max_confidence must be between 0 and 1")
+	}
+	if o.MinSimilarity <= 0 || o.MinSimilarity > 1 {
+		return fmt.Errorf("min_similarity must be in (0, 1]")
+	}
+	if o.Limit < 1 {
+		return fmt.Errorf("limit must be positive")
+	}
+	return nil
+}
+
+// Gap is a topic customers keep asking about that the help articles do not
+// cover well. Topic is the question closest to the middle of the group.
+type Gap struct {
+	Topic             string    `json:"topic"`
+	Queries           int       `json:"queries"`
+	Unanswered        int       `json:"unanswered"`
+	AverageConfidence float64   `json:"average_confidence"`
+	Examples          []string  `json:"examples"`
+	LastAsked         time.Time `json:"last_asked"`
+}
+
+type GapReport struct {
+	// Analyzed counts the low-confidence and unanswered queries grouped.
+	Analyzed int   `json:"analyzed"`
+	Topics   []Gap `json:"topics"`
+}
+
+// gapCluster groups questions by embedding; sum is the running sum of the
+// member vectors, which has the direction of their centroid.
+type gapCluster struct {
+	sum       []float32
+	questions []string
+	records   []QueryRecord
+}
+
+// KnowledgeGaps groups low-confidence and unanswered queries by the
+// similarity of their embeddings and reports the largest groups first.
+func (s *Service) KnowledgeGaps(ctx context.Context, opts GapOptions) (*GapReport, error) {
+	records := s.queryLog.Find(func(r QueryRecord) bool {
+		return r.At.After(opts.Since) && (!r.Answerable || r.Confidence < opts.MaxConfidence)
+	}, 0)
+
+	report := &GapReport{Analyzed: len(records), Topics: []Gap{}}
+	if len(records) == 0 {
+		return report, nil
+	}
+
+	// Embed each distinct question once, most asked first so common
+	// phrasings seed the topics.
+	byQuestion := make(map[string][]QueryRecord)
+	for _, r := range records {
+		key := strings.ToLower(strings.TrimSpace(r.SearchText()))
+		byQuestion[key] = append(byQuestion[key], r)
+	}
+	questions := make([]string, 0, len(byQuestion))
+	for q := range byQuestion {
+		questions = append(questions, q)
+	}
+	sort.Slice(questions, func(i, j int) bool {
+		if len(byQuestion[questions[i]]) != len(byQuestion[questions[j]]) {
+			return len(byQuestion[questions[i]]) > len(byQuestion[questions[j]])
+		}
+		return questions[i] < questions[j]
+	})
+
+	vectors, err := s.gapEmbeddings.embed(ctx, s.embeddingService, questions)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []*gapCluster
+	for i, q := range questions {
+		var best *gapCluster
+		bestScore := float32(0)
+		for _, c := range clusters {
+			score, err := embeddings.MetricCosine.Similarity(vectors[i], c.sum)
+			if err != nil {
+				return nil, err
+			}
+			if score >= float32(opts.MinSimilarity) && score > bestScore {
+				best, bestScore = c, score
+			}
+		}
+		if best == nil {
+			best = &gapCluster{sum: make([]float32, len(vectors[i]))}
+			clusters = append(clusters, best)
+		}
+		for d, v := range vectors[i] {
+			best.sum[d] += v
+		}
+		best.questions = append(best.questions, q)
+		best.records = append(best.records, byQuestion[q]...)
+	}
+
+	vectorOf := make(map[string][]float32, len(questions))
+	for i, q := range questions {
+		vectorOf[q] = vectors[i]
+	}
+
+	for _, c := range clusters {
+		report.Topics = append(report.Topics, c.gap(vectorOf))
+	}
+	sort.SliceStable(report.Topics, func(i, j int) bool {
+		a, b := report.Topics[i], report.Topics[j]
+		if a.Queries != b.Queries {
+			return a.Queries > b.Queries
+		}
+		return a.Unanswered > b.Unanswered
+	})
+	if len(report.Topics) > opts.Limit {
+		report.Topics = report.Topics[:opts.Limit]
+	}
+
+	return report, nil
+}
+
+func (c *gapCluster) gap(vectorOf map[string][]float32) Gap {
+	gap := Gap{Queries: len(c.records)}
+
+	bestScore := float32(-1)
+	for _, q := range c.questions {
+		if score, err := embeddings.MetricCosine.Similarity(vectorOf[q], c.sum); err == nil && score > bestScore {
+			bestScore = score
+			gap.Topic = q
+		}
+	}
+
+	// Examples keep the customer's wording, most recent first.
+	sort.Slice(c.records, func(i, j int) bool { return c.records[i].At.After(c.records[j].At) })
+	seen := make(map[string]bool)
+	total := 0.0
+	for _, r := range c.records {
+		total += r.Confidence
+		if !r.Answerable {
+			gap.Unanswered++
+		}
+		if r.At.After(gap.LastAsked) {
+			gap.LastAsked = r.At
+		}
+		if key := strings.ToLower(r.Question); len(gap.Examples) < gapExamples && !seen[key] {
+			seen[key] = true
+			gap.Examples = append(gap.Examples, r.Question)
+		}
+	}
+	gap.AverageConfidence = total / float64(len(c.records))
+
+	return gap
+}
+
+// gapEmbeddingCache remembers question embeddings between reports, keyed
+// by model so a migration to another model starts afresh.
+type gapEmbeddingCache struct {
+	model   string
+	vectors map[string][]float32
+	mu      sync.Mutex
+}
+
+func (c *gapEmbeddingCache) embed(ctx context.Context, service *embeddings.Service, questions []string) ([][]float32, error) {
+	model := service.Index().Model
+
+	c.mu.Lock()
+	if c.model != model || c.vectors == nil {
+		c.model = model
+		c.vectors = make(map[string][]float32)
+	}
+	var missing []string
+	for _, q := range questions {
+		if _, ok := c.vectors[q]; !ok {
+			missing = append(missing, q)
+		}
+	}
+	c.mu.Unlock()
+
+	for start := 0; start < len(missing); start += gapEmbedBatch {
+		batch := missing[start:min(start+gapEmbedBatch, len(missing))]
+		vectors, batchModel, err := service.EmbedTexts(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed questions: %w", err)
+		}
+
+		c.mu.Lock()
+		if batchModel == c.model {
+			for i, q := range batch {
+				c.vectors[q] = vectors[i]
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vectors := make([][]float32, len(questions))
+	for i, q := range questions {
+		vector, ok := c.vectors[q]
+		if !ok {
+			return nil, fmt.Errorf("embedding model changed while embedding questions")
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
@@ -0,0 +1,133 @@
+package knowledge_rag
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/jsonl"
+)
+
+// maxQueries bounds the queries kept in memory for analytics; a log file
+// keeps everything.
+const maxQueries = 10000
+
+// QueryRecord is one knowledge RAG request as seen by retrieval and the
+// answerability check.
+type QueryRecord struct {
+	ID             string             `json:"id"`
+	Question       string             `json:"question"`
+	Standalone     string             `json:"standalone,omitempty"`
+	ConversationID string             `json:"conversation_id"`
+	Mode           Mode               `json:"mode"`
+	Reranker       string             `json:"reranker,omitempty"`
+	Chunks         []RankedChunk      `json:"chunks,omitempty"`
+	Sources        []string           `json:"sources,omitempty"`
+	Confidence     float64            `json:"confidence"`
+	Answerable     bool               `json:"answerable"`
+	Reason         UnanswerableReason `json:"reason,omitempty"`
+	At             time.Time          `json:"at"`
+}
+
+// SearchText is the question as retrieval understood it.
+func (r QueryRecord) SearchText() string {
+	if r.Standalone != "" {
+		return r.Standalone
+	}
+	return r.Question
+}
+
+// QueryLog keeps recent queries in memory and, when opened on a file, also
+// appends every query to it as a JSON line.
+type QueryLog struct {
+	records []QueryRecord
+	file    *jsonl.Log
+	mu      sync.RWMutex
+}
+
+func NewQueryLog() *QueryLog {
+	return &QueryLog{}
+}
+
+// OpenQueryLog loads the most recent queries from path and appends new ones
+// to it.
+func OpenQueryLog(path string) (*QueryLog, error) {
+	l := NewQueryLog()
+	f, err := jsonl.Open(path, "query log", func(lineNo int, line []byte) error {
+		// Unlike the document logs, a bad entry only costs one data point.
+		var record QueryRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("Skipping corrupt query log entry at line %d: %v", lineNo, err)
+			return nil
+		}
+		l.add(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.file = f
+
+	return l, nil
+}
+
+// Record adds a query. A failed write to the log file is logged rather
+// than failing the request that is being recorded.
+func (l *QueryLog) Record(record QueryRecord) {
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(record)
+
+	if l.file == nil {
+		return
+	}
+	if err := l.file.Append(record); err != nil {
+		log.Printf("Failed to write query log: %v", err)
+	}
+}
+
+// Find returns the recorded queries accepted by match, newest first, up to
+// limit of them; a limit of 0 returns all.
+func (l *QueryLog) Find(match func(QueryRecord) bool, limit int) []QueryRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var records []QueryRecord
+	for i := len(l.records) - 1; i >= 0; i-- {
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		if match(l.records[i]) {
+			records = append(records, l.records[i])
+		}
+	}
+	return records
+}
+
+func (l *QueryLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *QueryLog) add(record QueryRecord) {
+	l.records = append(l.records, record)
+	// Trim in steps so the copy is not paid on every query.
+	if len(l.records) > maxQueries+maxQueries/10 {
+		l.records = append([]QueryRecord(nil), l.records[len(l.records)-maxQueries:]...)
+	}
+}
@@ -0,0 +1,247 @@
+package knowledge_rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/rerank"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+type Mode string
+
+const (
+	ModeHybrid  Mode = "hybrid"
+	ModeVector  Mode = "vector"
+	ModeKeyword Mode = "keyword"
+)
+
+type Fusion string
+
+const (
+	FusionRRF      Fusion = "rrf"
+	FusionWeighted Fusion = "weighted"
+)
+
+const (
+	// hybridDepth is how many candidates each retriever contributes to the
+	// fusion, as a multiple of the number of results wanted.
+	hybridDepth = 4
+
+	defaultWeight = 0.5
+)
+
+func (r Request) mode() Mode {
+	if r.Mode != "" {
+		return r.Mode
+	}
+	if r.UseVectorSearch {
+		return ModeVector
+	}
+	return ModeHybrid
+}
+
+func (r Request) Validate() error {
+	switch r.mode() {
+	case ModeHybrid, ModeVector, ModeKeyword:
+	default:
+		return fmt.Errorf("mode must be hybrid, vector or keyword")
+	}
+
+	switch r.Fusion {
+	case "", FusionRRF, FusionWeighted:
+	default:
+		return fmt.Errorf("fusion must be rrf or weighted")
+	}
+
+	if r.Reranker != "" && !rerank.IsKnown(r.Reranker) {
+		return fmt.Errorf("reranker must be none, lexical, llm-pointwise or llm-listwise")
+	}
+
+	if err := validateTransforms(r.QueryTransforms); err != nil {
+		return err
+	}
+
+	if err := validateCutoff(r); err != nil {
+		return err
+	}
+
+	if r.ContextTokens != nil && *r.ContextTokens <= 0 {
+		return fmt.Errorf("context_tokens must be positive")
+	}
+
+	keyword, vector := r.weights()
+	if keyword < 0 || vector < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	if keyword == 0 && vector == 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+
+	return r.Filter.Validate()
+}
+
+func (r Request) weights() (keyword, vector float64) {
+	keyword, vector = defaultWeight, defaultWeight
+	if r.KeywordWeight != nil {
+		keyword = *r.KeywordWeight
+	}
+	if r.VectorWeight != nil {
+		vector = *r.VectorWeight
+	}
+	return keyword, vector
+}
+
+// retrieve returns up to limit chunks from the documents the request may
+// see, ranked by the request's retrieval mode. With several queries each
+// is searched on its own and the rankings are fused. Vector search drops
+// chunks below minSimilarity so an unrelated question does not fill the
+// context with whatever happens to be closest.
+func (s *Service) retrieve(ctx context.Context, req Request, queries Queries, limit int, minSimilarity float64) ([]retrievedChunk, error) {
+	docs := s.docRepo.Find(req.Filter.WithVisibility(document.Visibility{
+		Audience: req.Audience,
+		At:       time.Now(),
+	}))
+	parents := make(map[string]document.Document, len(docs))
+	for _, doc := range docs {
+		parents[doc.ID] = doc
+	}
+
+	chunks := s.chunkStore.ChunksFor(docs)
+	byID := make(map[string]document.Chunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+
+	// Keep each chunk's best BM25 score and cosine similarity over the
+	// queries: fusion only passes on a combined score, but the similarity is
+	// a confidence signal and both explain the ranking.
+	keywordScore := make(map[string]float64)
+	similarity := make(map[string]float64)
+	note := func(scores map[string]float64, hits []search.Hit) {
+		for _, hit := range hits {
+			scores[hit.ID] = max(scores[hit.ID], hit.Score)
+		}
+	}
+
+	var lists [][]search.Hit
+	rankFused := false
+	for _, query := range queries.search() {
+		var hits []search.Hit
+		switch req.mode() {
+		case ModeVector:
+			var err error
+			if hits, err = s.vectorHits(ctx, query, chunks, limit, minSimilarity); err != nil {
+				return nil, err
+			}
+			note(similarity, hits)
+		case ModeKeyword:
+			hits = s.keywordHits(query, docs, limit)
+			note(keywordScore, hits)
+		default:
+			var keyword, vector []search.Hit
+			hits, keyword, vector = s.hybridHits(ctx, req, query, docs, chunks, limit, minSimilarity)
+			rankFused = req.Fusion != FusionWeighted
+			note(keywordScore, keyword)
+			note(similarity, vector)
+		}
+		lists = append(lists, hits)
+	}
+
+	// The hypothetical answer only makes sense as an embedding; its
+	// invented details would mislead keyword search.
+	if queries.Hypothetical != "" && req.mode() != ModeKeyword {
+		hits, err := s.vectorHits(ctx, queries.Hypothetical, chunks, limit, minSimilarity)
+		if err != nil {
+			log.Printf("Skipping hypothetical answer search: %v", err)
+		} else {
+			lists = append(lists, hits)
+		}
+	}
+
+	hits := lists[0]
+	if len(lists) > 1 {
+		weights := make([]float64, len(lists))
+		for i := range weights {
+			weights[i] = 1
+		}
+		hits = search.FuseRRF(lists, weights)
+		if len(hits) > limit {
+			hits = hits[:limit]
+		}
+		rankFused = true
+	}
+
+	retrieved := make([]retrievedChunk, 0, len(hits))
+	for _, hit := range hits {
+		chunk := byID[hit.ID]
+		retrieved = append(retrieved, retrievedChunk{
+			chunk:        chunk,
+			document:     parents[chunk.DocumentID],
+			score:        hit.Score,
+			keywordScore: keywordScore[hit.ID],
+			similarity:   similarity[hit.ID],
+			rankFused:    rankFused,
+		})
+	}
+	return retrieved, nil
+}
+
+// hybridHits fuses keyword and vector candidates and also returns the two
+// candidate lists on their own. If the embedding call fails the keyword
+// results are still used rather than failing the request.
+func (s *Service) hybridHits(ctx context.Context, req Request, query string, docs []document.Document, chunks []document.Chunk, limit int, minSimilarity float64) (fused, keyword, vector []search.Hit) {
+	depth := limit * hybridDepth
+	keywordWeight, vectorWeight := req.weights()
+
+	if keywordWeight > 0 {
+		keyword = s.keywordHits(query, docs, depth)
+	}
+	if vectorWeight > 0 {
+		var err error
+		if vector, err = s.vectorHits(ctx, query, chunks, depth, minSimilarity); err != nil {
+			log.Printf("Hybrid retrieval falling back to keyword results: %v", err)
+		}
+	}
+
+	lists := [][]search.Hit{keyword, vector}
+	weights := []float64{keywordWeight, vectorWeight}
+
+	if req.Fusion == FusionWeighted {
+		fused = search.FuseWeighted(lists, weights)
+	} else {
+		fused = search.FuseRRF(lists, weights)
+	}
+
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+	return fused, keyword, vector
+}
+
+func (s *Service) keywordHits(query string, docs []document.Document, limit int) []search.Hit {
+	results := s.chunkStore.Search(query, docs, limit)
+	hits := make([]search.Hit, len(results))
+	for i, result := range results {
+		hits[i] = search.Hit{ID: result.Chunk.ID, Score: result.Score}
+	}
+	return hits
+}
+
+func (s *Service) vectorHits(ctx context.Context, query string, chunks []document.Chunk, limit int, minSimilarity float64) ([]search.Hit, error) {
+	results, err := s.embeddingService.FindSimilarChunks(ctx, query, chunks, limit)
+	if err != nil {
+		return nil, fmt.Errorf("vector search failed: %w", err)
+	}
+
+	var hits []search.Hit
+	for _, result := range results {
+		if float64(result.Score) >= minSimilarity {
+			hits = append(hits, search.Hit{ID: result.Chunk.ID, Score: float64(result.Score)})
+		}
+	}
+	return hits, nil
+}
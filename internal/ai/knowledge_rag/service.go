@@ -3,105 +3,588 @@ package knowledge_rag
 import (
 	"context"
 	"fmt"
+	"log"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/chunking"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/rerank"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/tokens"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/dedup"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
 	"github.com/junjie-w/llm-integration-patterns-experiments/pkg/config"
 	"github.com/sashabaranov/go-openai"
 )
 
+// chatModel answers the question; the context budget is sized to its
+// context window.
+const chatModel = openai.GPT3Dot5Turbo
+
+const promptFormat = "Context:\n%s\n\nQuestion: %s"
+
+const systemPrompt = "You are a helpful customer support assistant. Answer based on the provided context when relevant, or say you don't know. Keep responses concise and accurate. " +
+	"After each sentence based on the context, cite the numbered passages that support it, e.g. [1] or [1][3]. Only cite passages that state what the sentence says. " +
+	"If the context does not answer the question, reply with exactly " + noAnswer + " and nothing else."
+
 type Service struct {
-	client          *openai.Client
-	docRepo         *document.Repository
-	embeddingService *embeddings.Service
+	client            *openai.Client
+	docRepo           *document.Repository
+	embeddingService  *embeddings.Service
+	chunkStore        *chunking.Store
+	duplicates        *dedup.Detector
+	collapseByDefault bool
+	rerankers         map[string]rerank.Reranker
+	defaultReranker   string
+	rerankCandidates  int
+	cutoffStrategy    Cutoff
+	cutoffRatio       float64
+	maxChunks         int
+	calibrations      *Calibrations
+	transforms        []Transform
+	conversations     *ConversationStore
+	tokens            *tokens.Counter
+	contextShare      float64
+	replyTokens       int
+	minConfidence     float64
+	queryLog          *QueryLog
+	gapEmbeddings     gapEmbeddingCache
 }
 
-func NewService(cfg *config.Config, docRepo *document.Repository, embeddingService *embeddings.Service) *Service {
+func NewService(cfg *config.Config, docRepo *document.Repository, embeddingService *embeddings.Service, chunkStore *chunking.Store, duplicates *dedup.Detector) *Service {
 	client := openai.NewClient(cfg.OpenAIKey)
+
+	rerankers := make(map[string]rerank.Reranker)
+	for _, name := range []string{rerank.Lexical, rerank.LLMPointwise, rerank.LLMListwise} {
+		rerankers[name], _ = rerank.New(name, client)
+	}
+
+	transforms := make([]Transform, len(cfg.QueryTransforms))
+	for i, t := range cfg.QueryTransforms {
+		transforms[i] = Transform(t)
+	}
+
 	return &Service{
-		client:          client,
-		docRepo:         docRepo,
-		embeddingService: embeddingService,
+		client:            client,
+		docRepo:           docRepo,
+		embeddingService:  embeddingService,
+		chunkStore:        chunkStore,
+		duplicates:        duplicates,
+		collapseByDefault: cfg.DedupCollapse,
+		rerankers:         rerankers,
+		defaultReranker:   cfg.Reranker,
+		rerankCandidates:  cfg.RerankCandidates,
+		cutoffStrategy:    Cutoff(cfg.RetrievalCutoff),
+		cutoffRatio:       cfg.CutoffRatio,
+		maxChunks:         cfg.MaxContextChunks,
+		calibrations:      NewCalibrations(),
+		transforms:        transforms,
+		conversations:     NewConversationStore(),
+		tokens:            tokens.ForModel(chatModel),
+		contextShare:      cfg.ContextBudget,
+		replyTokens:       cfg.ReplyMaxTokens,
+		minConfidence:     cfg.MinAnswerConfidence,
+		queryLog:          NewQueryLog(),
 	}
 }
 
 type Request struct {
 	Message string `json:"message"`
-	UseVectorSearch bool `json:"use_vector_search"`
+	// ConversationID continues an earlier conversation, so follow-ups are
+	// read against its history. A new conversation is started without it;
+	// IDs are only ever issued by the server, and an unknown one is an error.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// ConversationToken continues a conversation started without an API
+	// key; it is the token returned when the conversation was started.
+	ConversationToken string `json:"conversation_token,omitempty"`
+	// Owner identifies the caller, as set by the server. Only the caller
+	// that started a conversation can continue, read or delete it.
+	Owner string `json:"-"`
+	// Mode defaults to hybrid; the older UseVectorSearch flag still selects
+	// vector mode when Mode is not set.
+	Mode            Mode             `json:"mode,omitempty"`
+	UseVectorSearch bool             `json:"use_vector_search"`
+	Fusion          Fusion           `json:"fusion,omitempty"`
+	KeywordWeight   *float64         `json:"keyword_weight,omitempty"`
+	VectorWeight    *float64         `json:"vector_weight,omitempty"`
+	Filter          *document.Filter `json:"filter,omitempty"`
+	// Audience is who the answer is for; it defaults to public so drafts,
+	// expired and premium or internal documents stay out of the context.
+	// It is set by the server from the caller's API key, never from the
+	// request body.
+	Audience document.Audience `json:"-"`
+	// CollapseDuplicates overrides DEDUP_COLLAPSE for this request.
+	CollapseDuplicates *bool `json:"collapse_duplicates,omitempty"`
+	// Reranker overrides RERANKER for this request; "none" keeps the
+	// retrieval order.
+	Reranker string `json:"reranker,omitempty"`
+	// QueryTransforms overrides QUERY_TRANSFORMS for this request; an
+	// empty list searches with the message as is.
+	QueryTransforms []Transform `json:"query_transforms,omitempty"`
+	// ContextTokens overrides the context budget for this request. It is
+	// still capped by what the model's context window leaves free.
+	ContextTokens *int `json:"context_tokens,omitempty"`
+	// Cutoff, CutoffRatio and MaxChunks override RETRIEVAL_CUTOFF,
+	// CUTOFF_RATIO and MAX_CONTEXT_CHUNKS for this request.
+	Cutoff      Cutoff   `json:"cutoff,omitempty"`
+	CutoffRatio *float64 `json:"cutoff_ratio,omitempty"`
+	MaxChunks   *int     `json:"max_chunks,omitempty"`
+	// MinSimilarity overrides the vector similarity floor calibrated for
+	// the embedding model.
+	MinSimilarity *float64 `json:"min_similarity,omitempty"`
 }
 
 type Response struct {
+	ConversationID string `json:"conversation_id"`
+	// ConversationToken is issued when a caller without an API key starts
+	// a conversation, and must be sent back to continue, read or delete it.
+	ConversationToken string `json:"conversation_token,omitempty"`
+	// StandaloneQuestion is the follow-up rewritten with the conversation
+	// history, as used for retrieval.
+	StandaloneQuestion string `json:"standalone_question,omitempty"`
+	// Reply carries inline [n] markers numbering the chunks in Ranking.
 	Reply string `json:"reply"`
+	// Answerable is false when the help articles do not answer the
+	// question; Unanswerable then says why and Reply is a fixed apology.
+	Answerable   bool          `json:"answerable"`
+	Unanswerable *Unanswerable `json:"unanswerable,omitempty"`
+	// Confidence is how well the best context chunk matches the question,
+	// from 0 to 1.
+	Confidence float64 `json:"confidence"`
+	// Sources lists the documents the reply cites, in citation order.
 	Sources []document.Document `json:"sources,omitempty"`
+	// Sentences splits the reply into sentences with their citations.
+	Sentences []CitedSentence `json:"sentences,omitempty"`
+	// InvalidCitations lists markers the model emitted that do not number
+	// a context chunk; they are removed from Reply.
+	InvalidCitations []int `json:"invalid_citations,omitempty"`
+	// Collapsed lists documents left out of the context as near-duplicates
+	// of a source.
+	Collapsed []string `json:"collapsed,omitempty"`
+	// Reranker names the reranker that ordered the context, if any.
+	Reranker string `json:"reranker,omitempty"`
+	// Ranking scores each chunk put into the context, in context order.
+	Ranking []RankedChunk `json:"ranking,omitempty"`
+	// Queries shows what was searched with when query transforms ran.
+	Queries *Queries `json:"queries,omitempty"`
+	// Cutoff shows the thresholds the ranking was cut with.
+	Cutoff CutoffResult `json:"cutoff"`
+	// ContextTokens is what the context took out of ContextBudget.
+	ContextTokens int `json:"context_tokens"`
+	ContextBudget int `json:"context_budget"`
+}
+
+type RankedChunk struct {
+	ChunkID        string   `json:"chunk_id"`
+	DocumentID     string   `json:"document_id"`
+	RetrievalScore float64  `json:"retrieval_score"`
+	RerankScore    *float64 `json:"rerank_score,omitempty"`
+}
+
+// retrievedChunk pairs a chunk with its parent document so the context can
+// name the article and the response can cite it.
+type retrievedChunk struct {
+	chunk       document.Chunk
+	document    document.Document
+	score       float64
+	rerankScore *float64
+	// keywordScore and similarity are the chunk's BM25 score and cosine
+	// similarity for the question, or 0 when that search did not find it.
+	keywordScore float64
+	similarity   float64
+	// rankFused is set when score came from reciprocal rank fusion, which
+	// reflects ranks alone and says nothing about how good a match is.
+	rankFused bool
+	// text is the part of the chunk put into the prompt, without the
+	// overlap with a neighbouring chunk already there.
+	text string
+}
+
+// preparedAnswer is everything decided before the model is asked: the
+// question as retrieval understood it, the candidates and what became of
+// them, and the prompt.
+type preparedAnswer struct {
+	conversationID string
+	history        []Turn
+	question       string
+	transforms     []Transform
+	queries        Queries
+	reranker       rerank.Reranker
+	cutoff         CutoffResult
+
+	// owner is who the conversation belongs to; token is only set when a
+	// caller without an API key starts one.
+	owner string
+	token string
+
+	// candidates is every chunk retrieved, in reranked order; context is
+	// the part of it put into the prompt, in prompt order.
+	candidates    []retrievedChunk
+	collapsed     []string
+	skipped       map[string]Decision
+	context       []retrievedChunk
+	contextTokens int
+	budget        int
+
+	messages   []openai.ChatCompletionMessage
+	confidence float64
+	// unanswerable is set when retrieval already shows the question cannot
+	// be answered, so the model is not asked.
+	unanswerable *Unanswerable
 }
 
 func (s *Service) GetCompletion(ctx context.Context, req Request) (*Response, error) {
-	var relevantDocs []document.Document
-	
-	if req.UseVectorSearch {
-		results, err := s.embeddingService.FindSimilarDocuments(
-			ctx, 
-			req.Message, 
-			s.docRepo.List(), 
-			3,
-		)
+	p, err := s.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.answer(ctx, req, p)
+	if err != nil {
+		return nil, err
+	}
+
+	turn := Turn{
+		Question:   req.Message,
+		Standalone: response.StandaloneQuestion,
+		Reply:      response.Reply,
+		At:         time.Now(),
+	}
+	for _, doc := range response.Sources {
+		turn.Sources = append(turn.Sources, doc.ID)
+	}
+	s.conversations.Append(p.conversationID, p.owner, turn)
+
+	record := QueryRecord{
+		Question:       req.Message,
+		Standalone:     response.StandaloneQuestion,
+		ConversationID: p.conversationID,
+		Mode:           req.mode(),
+		Reranker:       response.Reranker,
+		Chunks:         response.Ranking,
+		Sources:        turn.Sources,
+		Confidence:     response.Confidence,
+		Answerable:     response.Answerable,
+		At:             turn.At,
+	}
+	if response.Unanswerable != nil {
+		record.Reason = response.Unanswerable.Reason
+	}
+	s.queryLog.Record(record)
+
+	return response, nil
+}
+
+// prepare runs everything up to the model call: condensing a follow-up,
+// query transforms, retrieval, reranking, duplicate collapsing, context
+// assembly and the answerability check on retrieval confidence.
+func (s *Service) prepare(ctx context.Context, req Request) (*preparedAnswer, error) {
+	p := &preparedAnswer{conversationID: req.ConversationID}
+	if p.conversationID == "" {
+		p.conversationID = newConversationID()
+		if req.Owner == "" {
+			p.token = newConversationToken()
+		}
+		p.owner = conversationOwner(req.Owner, p.token)
+	} else {
+		p.owner = conversationOwner(req.Owner, req.ConversationToken)
+		conversation, err := s.conversations.Get(p.conversationID, p.owner)
 		if err != nil {
-			return nil, fmt.Errorf("vector search failed: %w", err)
+			return nil, err
 		}
-		
-		for _, result := range results {
-			if result.Score > 0.7 {
-				relevantDocs = append(relevantDocs, result.Document)
+		p.history = recentTurns(conversation.Turns)
+	}
+
+	// Everything from here on works with the condensed question; the
+	// original message is only shown to the model with its history.
+	p.question = s.condense(ctx, req.Message, p.history)
+
+	collapse := s.collapseByDefault
+	if req.CollapseDuplicates != nil {
+		collapse = *req.CollapseDuplicates
+	}
+
+	// A reranker gets a wider candidate set to choose the context from.
+	// Otherwise over-fetch when collapsing so dropped duplicates leave room
+	// for other documents.
+	p.reranker = s.reranker(req)
+	p.cutoff = s.cutoff(req)
+	limit := p.cutoff.MaxChunks
+	if p.reranker != nil {
+		limit = max(s.rerankCandidates, limit)
+	} else if collapse {
+		limit *= 2
+	}
+
+	p.transforms = s.transforms
+	if req.QueryTransforms != nil {
+		p.transforms = req.QueryTransforms
+	}
+	p.queries = s.transformQuery(ctx, p.question, p.transforms)
+
+	retrieved, err := s.retrieve(ctx, req, p.queries, limit, p.cutoff.MinSimilarity)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.reranker != nil {
+		retrieved = s.rerank(ctx, p.reranker, p.question, retrieved)
+	}
+	p.candidates = retrieved
+
+	p.skipped = make(map[string]Decision)
+	if collapse {
+		var kept []retrievedChunk
+		kept, p.collapsed = s.collapseDuplicates(retrieved)
+		for _, r := range retrieved {
+			if slices.Contains(p.collapsed, r.document.ID) {
+				p.skipped[r.chunk.ID] = DecisionDuplicate
 			}
 		}
-	} else {
-		relevantDocs = s.docRepo.SearchByKeyword(req.Message)
-	}
-	
-	context := s.formatContext(relevantDocs)
-	
-	chatReq := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a helpful customer support assistant. Answer based on the provided context when relevant, or say you don't know. Keep responses concise and accurate.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: fmt.Sprintf("Context:\n%s\n\nQuestion: %s", context, req.Message),
-			},
+		retrieved = kept
+	}
+	retrieved = applyCutoff(retrieved, &p.cutoff, p.skipped)
+
+	p.messages = []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
 		},
-		Temperature: 0.7,
-		MaxTokens:   300,
 	}
+	p.messages = append(p.messages, historyMessages(p.history)...)
+	prompt := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf(promptFormat, "", req.Message),
+	}
+
+	// Size the budget with the prompt as it is without context, then fill
+	// it in once the chunks are chosen.
+	p.budget = s.contextBudget(req, append(p.messages, prompt))
+	p.context, p.contextTokens = assembleContext(retrieved, s.tokens, p.budget, p.cutoff.MaxChunks, p.skipped)
+
+	prompt.Content = fmt.Sprintf(promptFormat, s.formatContext(p.context), req.Message)
+	p.messages = append(p.messages, prompt)
+
+	// Only ask the model when retrieval found something that plausibly
+	// answers the question; the model may still decline.
+	p.confidence = confidence(ctx, p.question, p.context, p.cutoff.MinSimilarity)
+	switch {
+	case len(p.context) == 0:
+		p.unanswerable = newUnanswerable(ReasonNoDocuments)
+	case p.confidence < s.minConfidence:
+		p.unanswerable = newUnanswerable(ReasonLowConfidence)
+	}
+
+	return p, nil
+}
 
-	resp, err := s.client.CreateChatCompletion(ctx, chatReq)
+// answer asks the model unless preparation already found the question
+// unanswerable, and builds the response.
+func (s *Service) answer(ctx context.Context, req Request, p *preparedAnswer) (*Response, error) {
+	response := &Response{
+		ConversationID:    p.conversationID,
+		ConversationToken: p.token,
+		Collapsed:         p.collapsed,
+		Ranking:           ranking(p.context),
+		ContextTokens:     p.contextTokens,
+		ContextBudget:     p.budget,
+		Confidence:        p.confidence,
+		Unanswerable:      p.unanswerable,
+		Cutoff:            p.cutoff,
+	}
+	if p.reranker != nil {
+		response.Reranker = p.reranker.Name()
+	}
+	if len(p.transforms) > 0 {
+		response.Queries = &p.queries
+	}
+	if p.question != req.Message {
+		response.StandaloneQuestion = p.question
+	}
+
+	if response.Unanswerable == nil {
+		chatReq := openai.ChatCompletionRequest{
+			Model:       chatModel,
+			Messages:    p.messages,
+			Temperature: 0.7,
+			MaxTokens:   s.replyTokens,
+		}
+
+		resp, err := s.client.CreateChatCompletion(ctx, chatReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get completion: %w", err)
+		}
+
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("no completion choices returned")
+		}
+
+		content := resp.Choices[0].Message.Content
+		if declined(content) {
+			response.Unanswerable = newUnanswerable(ReasonModelDeclined)
+		} else {
+			reply := parseCitations(content, p.context)
+			response.Reply = reply.text
+			response.Sources = sourceDocuments(reply.cited)
+			response.Sentences = reply.sentences
+			response.InvalidCitations = reply.invalid
+		}
+	}
+
+	response.Answerable = response.Unanswerable == nil
+	if !response.Answerable {
+		response.Reply = unanswerableReply
+	}
+	return response, nil
+}
+
+// UseQueryLog replaces the in-memory query log, e.g. with one kept in a
+// file.
+func (s *Service) UseQueryLog(queryLog *QueryLog) {
+	s.queryLog = queryLog
+}
+
+// UnansweredQuestions lists up to limit recent questions that could not be
+// answered, newest first.
+func (s *Service) UnansweredQuestions(limit int) []QueryRecord {
+	return s.queryLog.Find(func(r QueryRecord) bool { return !r.Answerable }, limit)
+}
+
+// GetConversation returns the conversation if it belongs to the caller
+// with callerID, or to the anonymous caller holding token.
+func (s *Service) GetConversation(id, callerID, token string) (Conversation, error) {
+	return s.conversations.Get(id, conversationOwner(callerID, token))
+}
+
+func (s *Service) DeleteConversation(id, callerID, token string) error {
+	return s.conversations.Delete(id, conversationOwner(callerID, token))
+}
+
+// reranker returns the reranker the request asks for, falling back to the
+// configured one; nil means keep the retrieval order.
+func (s *Service) reranker(req Request) rerank.Reranker {
+	name := s.defaultReranker
+	if req.Reranker != "" {
+		name = req.Reranker
+	}
+	return s.rerankers[name]
+}
+
+// rerank reorders the candidates by reranker score. A failing reranker,
+// such as an LLM call that times out, leaves the retrieval order in place
+// rather than failing the request.
+func (s *Service) rerank(ctx context.Context, reranker rerank.Reranker, query string, retrieved []retrievedChunk) []retrievedChunk {
+	candidates := make([]rerank.Candidate, len(retrieved))
+	byID := make(map[string]retrievedChunk, len(retrieved))
+	for i, r := range retrieved {
+		candidates[i] = rerank.Candidate{ID: r.chunk.ID, Title: r.document.Title, Text: r.chunk.Content}
+		byID[r.chunk.ID] = r
+	}
+
+	results, err := reranker.Rerank(ctx, query, candidates)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get completion: %w", err)
+		log.Printf("Reranking with %s failed, keeping retrieval order: %v", reranker.Name(), err)
+		return retrieved
+	}
+
+	reranked := make([]retrievedChunk, 0, len(results))
+	for _, result := range results {
+		r := byID[result.ID]
+		score := result.Score
+		r.rerankScore = &score
+		reranked = append(reranked, r)
+	}
+	return reranked
+}
+
+func ranking(retrieved []retrievedChunk) []RankedChunk {
+	ranked := make([]RankedChunk, len(retrieved))
+	for i, r := range retrieved {
+		ranked[i] = RankedChunk{
+			ChunkID:        r.chunk.ID,
+			DocumentID:     r.document.ID,
+			RetrievalScore: r.score,
+			RerankScore:    r.rerankScore,
+		}
+	}
+	return ranked
+}
+
+// collapseDuplicates drops chunks whose document is a near-duplicate of a
+// document already retrieved, keeping the better ranked one whichever of
+// the two is canonical.
+func (s *Service) collapseDuplicates(retrieved []retrievedChunk) ([]retrievedChunk, []string) {
+	canonicals := s.duplicates.Canonicals()
+	if len(canonicals) == 0 {
+		return retrieved, nil
+	}
+
+	kept := make([]retrievedChunk, 0, len(retrieved))
+	var collapsed []string
+	chosen := make(map[string]string) // cluster canonical -> document kept
+	for _, r := range retrieved {
+		cluster, isDuplicate := canonicals[r.document.ID]
+		if !isDuplicate {
+			kept = append(kept, r)
+			continue
+		}
+
+		if keptID, exists := chosen[cluster]; exists && keptID != r.document.ID {
+			if !slices.Contains(collapsed, r.document.ID) {
+				collapsed = append(collapsed, r.document.ID)
+			}
+			continue
+		}
+		chosen[cluster] = r.document.ID
+		kept = append(kept, r)
+	}
+	return kept, collapsed
+}
+
+// sourceDocuments lists each parent document once, in the order its first
+// chunk appears.
+func sourceDocuments(retrieved []retrievedChunk) []document.Document {
+	var sources []document.Document
+	seen := make(map[string]bool)
+	for _, r := range retrieved {
+		if seen[r.document.ID] {
+			continue
+		}
+		seen[r.document.ID] = true
+		sources = append(sources, r.document)
 	}
+	return sources
+}
 
-	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no completion choices returned")
+// contextBudget is the share of the model's context window given to
+// retrieved chunks, or the request's own budget, capped by what the prompt
+// around the context and the reply leave free.
+func (s *Service) contextBudget(req Request, messages []openai.ChatCompletionMessage) int {
+	window := tokens.ContextWindow(chatModel)
+
+	free := window - s.replyTokens
+	for _, message := range messages {
+		free -= s.tokens.Count(message.Content) + messageOverhead
 	}
 
-	return &Response{
-		Reply:   resp.Choices[0].Message.Content,
-		Sources: relevantDocs,
-	}, nil
+	budget := int(float64(window) * s.contextShare)
+	if req.ContextTokens != nil {
+		budget = *req.ContextTokens
+	}
+	return max(min(budget, free), 0)
 }
 
-func (s *Service) formatContext(docs []document.Document) string {
-	if len(docs) == 0 {
+func (s *Service) formatContext(retrieved []retrievedChunk) string {
+	if len(retrieved) == 0 {
 		return "No relevant information found."
 	}
-	
+
 	var builder strings.Builder
-	
-	for i, doc := range docs {
-		builder.WriteString(fmt.Sprintf("[%d] %s\n%s\n\n", i+1, doc.Title, doc.Content))
+
+	for i, r := range retrieved {
+		builder.WriteString(formatEntry(i+1, r))
 	}
-	
+
 	return builder.String()
 }
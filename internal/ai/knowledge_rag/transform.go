@@ -0,0 +1,197 @@
+package knowledge_rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type Transform string
+
+const (
+	// TransformRewrite turns the message into a standalone search query.
+	TransformRewrite Transform = "rewrite"
+	// TransformMultiQuery adds alternative phrasings of the question.
+	TransformMultiQuery Transform = "multi_query"
+	// TransformHyDE drafts a hypothetical answer and searches with its
+	// embedding, which tends to sit closer to the answering passage than
+	// the question does.
+	TransformHyDE Transform = "hyde"
+)
+
+// queryExpansions is how many alternative phrasings multi_query asks for.
+const queryExpansions = 3
+
+func validateTransforms(transforms []Transform) error {
+	for _, t := range transforms {
+		switch t {
+		case TransformRewrite, TransformMultiQuery, TransformHyDE:
+		default:
+			return fmt.Errorf("query transform must be rewrite, multi_query or hyde, got %q", t)
+		}
+	}
+	return nil
+}
+
+// Queries reports what retrieval searched with. Keyword and vector search
+// run for the original message, the rewrite and each expansion, the
+// hypothetical answer is only embedded, and the rankings are fused.
+type Queries struct {
+	Original     string   `json:"original"`
+	Rewritten    string   `json:"rewritten,omitempty"`
+	Expansions   []string `json:"expansions,omitempty"`
+	Hypothetical string   `json:"hypothetical,omitempty"`
+	// Errors names transforms that failed; retrieval went ahead without
+	// them.
+	Errors map[Transform]string `json:"errors,omitempty"`
+}
+
+// search lists the distinct queries to run keyword and vector search for.
+func (q Queries) search() []string {
+	queries := []string{q.Original}
+	for _, query := range append([]string{q.Rewritten}, q.Expansions...) {
+		query = strings.TrimSpace(query)
+		if query != "" && !slices.ContainsFunc(queries, func(existing string) bool {
+			return strings.EqualFold(existing, query)
+		}) {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// transformQuery runs the requested transforms concurrently. A failing
+// transform is recorded in Errors rather than failing the request.
+func (s *Service) transformQuery(ctx context.Context, message string, transforms []Transform) Queries {
+	queries := Queries{Original: message}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range transforms {
+		wg.Add(1)
+		go func(t Transform) {
+			defer wg.Done()
+
+			var err error
+			switch t {
+			case TransformRewrite:
+				var rewritten string
+				if rewritten, err = s.rewriteQuery(ctx, message); err == nil {
+					mu.Lock()
+					queries.Rewritten = rewritten
+					mu.Unlock()
+				}
+			case TransformMultiQuery:
+				var expansions []string
+				if expansions, err = s.expandQuery(ctx, message); err == nil {
+					mu.Lock()
+					queries.Expansions = expansions
+					mu.Unlock()
+				}
+			case TransformHyDE:
+				var hypothetical string
+				if hypothetical, err = s.hypotheticalAnswer(ctx, message); err == nil {
+					mu.Lock()
+					queries.Hypothetical = hypothetical
+					mu.Unlock()
+				}
+			}
+
+			if err != nil {
+				log.Printf("Query transform %s failed: %v", t, err)
+				mu.Lock()
+				if queries.Errors == nil {
+					queries.Errors = make(map[Transform]string)
+				}
+				queries.Errors[t] = err.Error()
+				mu.Unlock()
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	return queries
+}
+
+func (s *Service) rewriteQuery(ctx context.Context, message string) (string, error) {
+	var out struct {
+		Query string `json:"query"`
+	}
+	err := s.completeJSON(ctx,
+		"You turn customer support messages into search queries for a help center. Reply with JSON only.",
+		fmt.Sprintf("Message: %s\n\nRewrite the message as one concise, standalone search query that keeps every product, policy and detail it mentions and drops greetings and filler. Reply with JSON {\"query\": \"...\"}.", message),
+		100, &out)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.Query), nil
+}
+
+func (s *Service) expandQuery(ctx context.Context, message string) ([]string, error) {
+	var out struct {
+		Queries []string `json:"queries"`
+	}
+	err := s.completeJSON(ctx,
+		"You turn customer support messages into search queries for a help center. Reply with JSON only.",
+		fmt.Sprintf("Message: %s\n\nWrite %d different search queries that could find the help article answering this message, using other words than the message where possible. Reply with JSON {\"queries\": [\"...\"]}.", message, queryExpansions),
+		200, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	var expansions []string
+	for _, query := range out.Queries {
+		if query = strings.TrimSpace(query); query != "" {
+			expansions = append(expansions, query)
+		}
+	}
+	if len(expansions) > queryExpansions {
+		expansions = expansions[:queryExpansions]
+	}
+	return expansions, nil
+}
+
+func (s *Service) hypotheticalAnswer(ctx context.Context, message string) (string, error) {
+	var out struct {
+		Answer string `json:"answer"`
+	}
+	err := s.completeJSON(ctx,
+		"You write help center articles for an online store. Reply with JSON only.",
+		fmt.Sprintf("Question: %s\n\nWrite a short passage, two or three sentences, as it might appear in the help article that answers this question. Plausible details are fine; it is only used to search. Reply with JSON {\"answer\": \"...\"}.", message),
+		200, &out)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.Answer), nil
+}
+
+func (s *Service) completeJSON(ctx context.Context, system, prompt string, maxTokens int, out any) error {
+	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: openai.GPT3Dot5Turbo,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		Temperature:    0,
+		MaxTokens:      maxTokens,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("no completion choices returned")
+	}
+
+	content := resp.Choices[0].Message.Content
+	if err := json.Unmarshal([]byte(content), out); err != nil {
+		return fmt.Errorf("invalid response %q: %w", content, err)
+	}
+	return nil
+}
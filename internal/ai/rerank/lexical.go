@@ -0,0 +1,118 @@
+package rerank
+
+import (
+	"context"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
+)
+
+// LexicalReranker scores query-passage pairs locally, looking at the pair
+// as a whole the way a cross-encoder would rather than term by term as
+// BM25 does: how many query terms the passage covers, how close together
+// they occur, whether they appear in the query's order, and whether the
+// title matches.
+type LexicalReranker struct{}
+
+func (r *LexicalReranker) Name() string { return Lexical }
+
+func (r *LexicalReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Result, error) {
+	queryTerms := search.Terms(query)
+
+	results := make([]Result, len(candidates))
+	for i, c := range candidates {
+		results[i] = Result{ID: c.ID, Score: lexicalScore(queryTerms, c)}
+	}
+	sortResults(results)
+	return results, nil
+}
+
+func lexicalScore(queryTerms []string, c Candidate) float64 {
+	wanted := make(map[string]bool)
+	for _, term := range queryTerms {
+		wanted[term] = true
+	}
+	if len(wanted) == 0 {
+		return 0
+	}
+
+	var positions []int
+	var terms []string
+	for i, token := range search.Analyze(c.Text) {
+		terms = append(terms, token.Term)
+		if wanted[token.Term] {
+			positions = append(positions, i)
+		}
+	}
+
+	matched := make(map[string]bool)
+	for _, p := range positions {
+		matched[terms[p]] = true
+	}
+	coverage := float64(len(matched)) / float64(len(wanted))
+
+	return 0.45*coverage +
+		0.25*proximity(terms, positions, len(matched)) +
+		0.2*bigramOverlap(queryTerms, terms) +
+		0.1*titleCoverage(wanted, c.Title)
+}
+
+// proximity is distinct/width for the narrowest window of the passage that
+// contains every distinct matched term, so 1 means they sit side by side.
+func proximity(terms []string, positions []int, distinct int) float64 {
+	if distinct == 0 {
+		return 0
+	}
+
+	best := len(terms)
+	counts := make(map[string]int)
+	have, left := 0, 0
+	for right := 0; right < len(positions); right++ {
+		term := terms[positions[right]]
+		if counts[term] == 0 {
+			have++
+		}
+		counts[term]++
+
+		for have == distinct {
+			best = min(best, positions[right]-positions[left]+1)
+			leftTerm := terms[positions[left]]
+			counts[leftTerm]--
+			if counts[leftTerm] == 0 {
+				have--
+			}
+			left++
+		}
+	}
+	return float64(distinct) / float64(best)
+}
+
+// bigramOverlap is the share of the query's adjacent term pairs that also
+// appear adjacent in the passage.
+func bigramOverlap(queryTerms, terms []string) float64 {
+	if len(queryTerms) < 2 {
+		return 0
+	}
+
+	present := make(map[[2]string]bool)
+	for i := 0; i+1 < len(terms); i++ {
+		present[[2]string{terms[i], terms[i+1]}] = true
+	}
+
+	found := 0
+	for i := 0; i+1 < len(queryTerms); i++ {
+		if present[[2]string{queryTerms[i], queryTerms[i+1]}] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(queryTerms)-1)
+}
+
+func titleCoverage(wanted map[string]bool, title string) float64 {
+	matched := make(map[string]bool)
+	for _, term := range search.Terms(title) {
+		if wanted[term] {
+			matched[term] = true
+		}
+	}
+	return float64(len(matched)) / float64(len(wanted))
+}
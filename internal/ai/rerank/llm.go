@@ -0,0 +1,166 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxPassageChars = 1500
+
+	// pointwiseConcurrency bounds the parallel scoring requests.
+	pointwiseConcurrency = 5
+)
+
+// PointwiseReranker asks the model to grade each passage on its own, in
+// parallel. It is the more robust of the two LLM rerankers but costs one
+// request per candidate.
+type PointwiseReranker struct {
+	client *openai.Client
+	model  string
+}
+
+func (r *PointwiseReranker) Name() string { return LLMPointwise }
+
+func (r *PointwiseReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Result, error) {
+	results := make([]Result, len(candidates))
+	errs := make([]error, len(candidates))
+
+	sem := make(chan struct{}, pointwiseConcurrency)
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		wg.Add(1)
+		go func(i int, c Candidate) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			score, err := r.grade(ctx, query, c)
+			results[i] = Result{ID: c.ID, Score: score}
+			errs[i] = err
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to grade %s: %w", candidates[i].ID, err)
+		}
+	}
+
+	sortResults(results)
+	return results, nil
+}
+
+func (r *PointwiseReranker) grade(ctx context.Context, query string, c Candidate) (float64, error) {
+	prompt := fmt.Sprintf(
+		"Query: %s\n\nPassage (%s):\n%s\n\nHow well does the passage help answer the query? "+
+			"Reply with JSON {\"score\": n} where n is an integer from 0 (irrelevant) to 10 (answers it fully).",
+		query, c.Title, truncate(c.Text, maxPassageChars),
+	)
+
+	content, err := r.complete(ctx, prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	var grade struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.Unmarshal([]byte(content), &grade); err != nil {
+		return 0, fmt.Errorf("invalid grade %q: %w", content, err)
+	}
+	return min(max(grade.Score, 0), 10) / 10, nil
+}
+
+func (r *PointwiseReranker) complete(ctx context.Context, prompt string) (string, error) {
+	return complete(ctx, r.client, r.model, prompt, 20)
+}
+
+// ListwiseReranker shows the model every candidate at once and asks for an
+// ordering, which lets it compare passages directly in a single request.
+type ListwiseReranker struct {
+	client *openai.Client
+	model  string
+}
+
+func (r *ListwiseReranker) Name() string { return LLMListwise }
+
+func (r *ListwiseReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Result, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Query: %s\n\nPassages:\n", query)
+	for i, c := range candidates {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, c.Title, truncate(c.Text, maxPassageChars/2))
+	}
+	b.WriteString("Rank the passages by how well they help answer the query, most helpful first. " +
+		"Reply with JSON {\"ranking\": [passage numbers]}; leave out passages that do not help at all.")
+
+	content, err := complete(ctx, r.client, r.model, b.String(), 200)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranking struct {
+		Ranking []int `json:"ranking"`
+	}
+	if err := json.Unmarshal([]byte(content), &ranking); err != nil {
+		return nil, fmt.Errorf("invalid ranking %q: %w", content, err)
+	}
+
+	// Ranked passages score from 1 down towards 0.5; passages left out keep
+	// their retrieval order below them.
+	n := float64(len(candidates))
+	results := make([]Result, 0, len(candidates))
+	placed := make(map[int]bool)
+	for rank, number := range ranking.Ranking {
+		i := number - 1
+		if i < 0 || i >= len(candidates) || placed[i] {
+			continue
+		}
+		placed[i] = true
+		results = append(results, Result{ID: candidates[i].ID, Score: 1 - 0.5*float64(rank)/n})
+	}
+	for i, c := range candidates {
+		if !placed[i] {
+			results = append(results, Result{ID: c.ID, Score: 0.5 * (1 - float64(i)/n)})
+		}
+	}
+
+	sortResults(results)
+	return results, nil
+}
+
+func complete(ctx context.Context, client *openai.Client, model, prompt string, maxTokens int) (string, error) {
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You judge the relevance of help center passages to customer questions. Reply with JSON only.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature:    0,
+		MaxTokens:      maxTokens,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no completion choices returned")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
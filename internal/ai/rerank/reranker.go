@@ -0,0 +1,81 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	None         = "none"
+	Lexical      = "lexical"
+	LLMPointwise = "llm-pointwise"
+	LLMListwise  = "llm-listwise"
+)
+
+// Candidate is a retrieved passage to be reranked against a query.
+type Candidate struct {
+	ID    string
+	Title string
+	Text  string
+}
+
+type Result struct {
+	ID    string
+	Score float64
+}
+
+// Reranker scores candidates against a query more carefully than the first
+// retrieval stage could afford to, returning every candidate best first.
+// Scores are in [0, 1].
+type Reranker interface {
+	Name() string
+	Rerank(ctx context.Context, query string, candidates []Candidate) ([]Result, error)
+}
+
+func IsKnown(name string) bool {
+	switch name {
+	case None, Lexical, LLMPointwise, LLMListwise:
+		return true
+	}
+	return false
+}
+
+// New returns the named reranker, or nil for "none".
+func New(name string, client *openai.Client) (Reranker, error) {
+	switch name {
+	case None:
+		return nil, nil
+	case Lexical:
+		return &LexicalReranker{}, nil
+	case LLMPointwise:
+		return &PointwiseReranker{client: client, model: openai.GPT3Dot5Turbo}, nil
+	case LLMListwise:
+		return &ListwiseReranker{client: client, model: openai.GPT3Dot5Turbo}, nil
+	default:
+		return nil, fmt.Errorf("unknown reranker %q", name)
+	}
+}
+
+// sortResults orders results best first, keeping the retrieval order of
+// candidates with equal scores.
+func sortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// truncate keeps prompts bounded for long chunks. n counts bytes, and the
+// cut moves back to the start of a rune so a character is never split.
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "..."
+}
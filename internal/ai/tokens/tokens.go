@@ -0,0 +1,100 @@
+package tokens
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// defaultContextWindow is assumed for models missing from contextWindows.
+const defaultContextWindow = 4096
+
+// contextWindows lists the context sizes, in tokens, of the chat models the
+// services use. Longer names come first so prefixes match the most specific
+// entry.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-instruct", 4096},
+	{"gpt-3.5-turbo", 16385},
+}
+
+// ContextWindow returns how many tokens the model accepts, prompt and
+// completion together.
+func ContextWindow(model string) int {
+	for _, w := range contextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return w.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+// Counter counts tokens the way the model's own tokenizer does. The BPE
+// ranks are embedded in the binary so counting needs no network access.
+type Counter struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var (
+	loaderOnce sync.Once
+	counters   sync.Map // model -> *Counter
+)
+
+// ForModel returns the counter for model, falling back to cl100k_base for
+// models the tokenizer does not know.
+func ForModel(model string) *Counter {
+	if counter, ok := counters.Load(model); ok {
+		return counter.(*Counter)
+	}
+
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		if encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE); err != nil {
+			log.Printf("Failed to load tokenizer, estimating token counts: %v", err)
+		}
+	}
+
+	counter, _ := counters.LoadOrStore(model, &Counter{encoding: encoding})
+	return counter.(*Counter)
+}
+
+func (c *Counter) Count(text string) int {
+	if c.encoding == nil {
+		// Roughly four tokens for every three English words.
+		return (len(strings.Fields(text))*4 + 2) / 3
+	}
+	return len(c.encoding.EncodeOrdinary(text))
+}
+
+// Truncate cuts text to at most n tokens.
+func (c *Counter) Truncate(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if c.encoding == nil {
+		words := strings.Fields(text)
+		if limit := n * 3 / 4; len(words) > limit {
+			return strings.Join(words[:limit], " ")
+		}
+		return text
+	}
+
+	ids := c.encoding.EncodeOrdinary(text)
+	if len(ids) <= n {
+		return text
+	}
+	return c.encoding.Decode(ids[:n])
+}
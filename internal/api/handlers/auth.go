@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// RoleAdmin is the API key role for managing documents and indexes; the
+// other roles are the document audiences.
+const RoleAdmin = "admin"
+
+const callerKey = "caller"
+
+// Caller is who sent a request, as established from its API key. Requests
+// without a key come from the public.
+type Caller struct {
+	// ID tells API keys apart without holding the key itself; it is empty
+	// for the public.
+	ID       string
+	Audience document.Audience
+	Admin    bool
+}
+
+var publicCaller = Caller{Audience: document.AudiencePublic}
+
+// Authenticate identifies the caller from an "Authorization: Bearer <key>"
+// header. keys maps each API key to a role: an audience, or admin, which
+// reads as internal and may also manage documents. A key that is not known
+// is rejected rather than treated as public, so a typo does not silently
+// hide documents.
+func Authenticate(keys map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := publicCaller
+		if header := c.GetHeader("Authorization"); header != "" {
+			key, ok := strings.CutPrefix(header, "Bearer ")
+			role, known := lookupKey(keys, key)
+			if !ok || !known {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			caller = callerFor(role)
+			caller.ID = keyID(key)
+		}
+		c.Set(callerKey, caller)
+		c.Next()
+	}
+}
+
+// RequireKey rejects callers without an API key, for endpoints that spend
+// on the model provider with no retrieval to show for it.
+func RequireKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if callerOf(c).ID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "An API key is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects callers without an admin API key.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !callerOf(c).Admin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "An admin API key is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// lookupKey compares key with every configured key in constant time so the
+// response time does not reveal how much of a key was right.
+func lookupKey(keys map[string]string, key string) (string, bool) {
+	var role string
+	found := false
+	for k, r := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			role, found = r, true
+		}
+	}
+	return role, found
+}
+
+func callerFor(role string) Caller {
+	if role == RoleAdmin {
+		return Caller{Audience: document.AudienceInternal, Admin: true}
+	}
+	return Caller{Audience: document.Audience(role)}
+}
+
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func callerOf(c *gin.Context) Caller {
+	if v, ok := c.Get(callerKey); ok {
+		if caller, ok := v.(Caller); ok {
+			return caller
+		}
+	}
+	return publicCaller
+}
+
+func (c Caller) visibility() document.Visibility {
+	return document.Visibility{Audience: c.Audience, At: time.Now()}
+}
+
+// filter restricts f, which may be nil, to the documents the caller may
+// read. Admins manage drafts and expired documents, so they see them all.
+func (c Caller) filter(f *document.Filter) *document.Filter {
+	if c.Admin {
+		return f
+	}
+	return f.WithVisibility(c.visibility())
+}
+
+// canRead reports whether the caller may read doc.
+func (c Caller) canRead(doc document.Document) bool {
+	return c.Admin || c.visibility().Allows(doc)
+}
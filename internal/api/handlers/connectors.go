@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/connector"
+)
+
+type ConnectorsHandler struct {
+	manager *connector.Manager
+}
+
+func NewConnectorsHandler(manager *connector.Manager) *ConnectorsHandler {
+	return &ConnectorsHandler{
+		manager: manager,
+	}
+}
+
+func (h *ConnectorsHandler) HandleListConnectors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"connectors": h.manager.Statuses()})
+}
+
+func (h *ConnectorsHandler) HandleSync(c *gin.Context) {
+	confirmEmpty := c.Query("confirm_empty") == "true"
+	status, err := h.manager.Sync(c.Request.Context(), c.Param("name"), confirmEmpty)
+	if err != nil {
+		switch {
+		case errors.Is(err, connector.ErrUnknownConnector):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connector not found"})
+		case errors.Is(err, connector.ErrSyncInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": "A sync of this connector is already running"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync connector"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type DocumentsHandler struct {
+	docRepo *document.Repository
+}
+
+func NewDocumentsHandler(docRepo *document.Repository) *DocumentsHandler {
+	return &DocumentsHandler{
+		docRepo: docRepo,
+	}
+}
+
+type documentRequest struct {
+	ID      string            `json:"id"`
+	Title   string            `json:"title"`
+	Content string            `json:"content"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Author  string            `json:"author"`
+
+	Status     document.Status   `json:"status"`
+	Audience   document.Audience `json:"audience"`
+	ValidFrom  *time.Time        `json:"valid_from"`
+	ValidUntil *time.Time        `json:"valid_until"`
+}
+
+func (r documentRequest) toDocument() document.Document {
+	// A document written here is never a connector's to delete.
+	delete(r.Meta, document.MetaConnector)
+
+	return document.Document{
+		ID:      r.ID,
+		Title:   r.Title,
+		Content: r.Content,
+		Tags:    r.Tags,
+		Meta:    r.Meta,
+		Author:  r.Author,
+
+		Status:     r.Status,
+		Audience:   r.Audience,
+		ValidFrom:  r.ValidFrom,
+		ValidUntil: r.ValidUntil,
+	}
+}
+
+type listDocumentsResponse struct {
+	Documents []document.Document `json:"documents"`
+	Total     int                 `json:"total"`
+	Offset    int                 `json:"offset"`
+	Limit     int                 `json:"limit"`
+}
+
+func (h *DocumentsHandler) HandleListDocuments(c *gin.Context) {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Offset must be a non-negative integer"})
+		return
+	}
+
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+		return
+	}
+
+	var filter *document.Filter
+	if tags := c.QueryArray("tag"); len(tags) > 0 {
+		filter = &document.Filter{Tags: tags}
+	}
+
+	docs, total := h.docRepo.ListPage(callerOf(c).filter(filter), offset, limit)
+
+	c.JSON(http.StatusOK, listDocumentsResponse{
+		Documents: docs,
+		Total:     total,
+		Offset:    offset,
+		Limit:     limit,
+	})
+}
+
+type searchDocumentsResponse struct {
+	Query   string                   `json:"query"`
+	Results []document.KeywordResult `json:"results"`
+}
+
+func (h *DocumentsHandler) HandleSearchDocuments(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+		return
+	}
+
+	var filter *document.Filter
+	if tags := c.QueryArray("tag"); len(tags) > 0 {
+		filter = &document.Filter{Tags: tags}
+	}
+
+	c.JSON(http.StatusOK, searchDocumentsResponse{
+		Query:   query,
+		Results: h.docRepo.Search(query, callerOf(c).filter(filter), limit),
+	})
+}
+
+func (h *DocumentsHandler) HandleGetDocument(c *gin.Context) {
+	// A document the caller may not read is reported as missing, so its
+	// existence is not revealed either.
+	doc, exists := h.docRepo.Get(c.Param("id"))
+	if !exists || !callerOf(c).canRead(doc) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+func (h *DocumentsHandler) HandleCreateDocument(c *gin.Context) {
+	var req documentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	doc := req.toDocument()
+	if err := doc.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document: " + err.Error()})
+		return
+	}
+
+	created, err := h.docRepo.Create(doc)
+	if err != nil {
+		if errors.Is(err, document.ErrAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Document already exists"})
+			return
+		}
+		if errors.Is(err, document.ErrRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *DocumentsHandler) HandleUpdateDocument(c *gin.Context) {
+	var req documentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	id := c.Param("id")
+	if req.ID != "" && req.ID != id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document ID in body does not match URL"})
+		return
+	}
+	req.ID = id
+
+	doc := req.toDocument()
+	if err := doc.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document: " + err.Error()})
+		return
+	}
+
+	updated, err := h.docRepo.Update(doc)
+	if err != nil {
+		if errors.Is(err, document.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		if errors.Is(err, document.ErrRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func (h *DocumentsHandler) HandleDeleteDocument(c *gin.Context) {
+	if err := h.docRepo.Delete(c.Param("id")); err != nil {
+		if errors.Is(err, document.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type versionSummary struct {
+	Version   int       `json:"version"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type versionResponse struct {
+	Document document.Document     `json:"document"`
+	Diff     *document.VersionDiff `json:"diff,omitempty"`
+}
+
+type rollbackRequest struct {
+	Author string `json:"author"`
+}
+
+func (h *DocumentsHandler) HandleListVersions(c *gin.Context) {
+	versions := h.docRepo.Versions(c.Param("id"))
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	summaries := make([]versionSummary, len(versions))
+	for i, doc := range versions {
+		summaries[i] = versionSummary{
+			Version:   doc.Version,
+			Title:     doc.Title,
+			Author:    doc.Author,
+			UpdatedAt: doc.UpdatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": summaries})
+}
+
+// HandleGetVersion returns a version together with its diff against the
+// version before it.
+func (h *DocumentsHandler) HandleGetVersion(c *gin.Context) {
+	id := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Version must be an integer"})
+		return
+	}
+
+	doc, err := h.docRepo.Version(id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document version not found"})
+		return
+	}
+
+	resp := versionResponse{Document: doc}
+	versions := h.docRepo.Versions(id)
+	for i := 1; i < len(versions); i++ {
+		if versions[i].Version == version {
+			diff := document.Diff(versions[i-1], doc)
+			resp.Diff = &diff
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *DocumentsHandler) HandleRollback(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Version must be an integer"})
+		return
+	}
+
+	var req rollbackRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	doc, err := h.docRepo.Rollback(c.Param("id"), version, req.Author)
+	if err != nil {
+		if errors.Is(err, document.ErrVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document version not found"})
+			return
+		}
+		if errors.Is(err, document.ErrRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+func queryInt(c *gin.Context, key string, fallback int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
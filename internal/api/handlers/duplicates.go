@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/dedup"
+)
+
+type DuplicatesHandler struct {
+	detector *dedup.Detector
+}
+
+func NewDuplicatesHandler(detector *dedup.Detector) *DuplicatesHandler {
+	return &DuplicatesHandler{
+		detector: detector,
+	}
+}
+
+// HandleGetDuplicates reports clusters of near-duplicate documents. The
+// thresholds can be overridden with min_jaccard, max_hamming and
+// min_similarity query parameters.
+func (h *DuplicatesHandler) HandleGetDuplicates(c *gin.Context) {
+	opts := h.detector.Options()
+	overridden := false
+
+	if v := c.Query("min_jaccard"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_jaccard must be a number"})
+			return
+		}
+		opts.MinJaccard, overridden = f, true
+	}
+	if v := c.Query("max_hamming"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_hamming must be an integer"})
+			return
+		}
+		opts.MaxHamming, overridden = n, true
+	}
+	if v := c.Query("min_similarity"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_similarity must be a number"})
+			return
+		}
+		opts.MinSimilarity, overridden = float32(f), true
+	}
+
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !overridden {
+		c.JSON(http.StatusOK, h.detector.Report(c.Request.Context()))
+		return
+	}
+	c.JSON(http.StatusOK, h.detector.Detect(c.Request.Context(), opts))
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/chunking"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+type EmbeddingsHandler struct {
+	service    *embeddings.Service
+	docRepo    *document.Repository
+	chunkStore *chunking.Store
+}
+
+func NewEmbeddingsHandler(service *embeddings.Service, docRepo *document.Repository, chunkStore *chunking.Store) *EmbeddingsHandler {
+	return &EmbeddingsHandler{
+		service:    service,
+		docRepo:    docRepo,
+		chunkStore: chunkStore,
+	}
+}
+
+const (
+	maxEmbedTexts      = 100
+	defaultSearchLimit = 5
+)
+
+type embedRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type embedResponse struct {
+	Model     string      `json:"model"`
+	Dimension int         `json:"dimension"`
+	Data      [][]float32 `json:"data"`
+}
+
+type searchRequest struct {
+	Query  string           `json:"query"`
+	Vector []float32        `json:"vector,omitempty"`
+	Model  string           `json:"model,omitempty"`
+	Limit  int              `json:"limit"`
+	Filter *document.Filter `json:"filter,omitempty"`
+}
+
+type searchResult struct {
+	Document document.Document `json:"document"`
+	Score    float32           `json:"score"`
+}
+
+type searchResponse struct {
+	Model   string            `json:"model"`
+	Metric  embeddings.Metric `json:"metric"`
+	Results []searchResult    `json:"results"`
+}
+
+type startMigrationRequest struct {
+	Model     string `json:"model"`
+	Metric    string `json:"metric"`
+	Normalize bool   `json:"normalize"`
+}
+
+func (h *EmbeddingsHandler) HandleEmbed(c *gin.Context) {
+	var req embedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if len(req.Texts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Texts cannot be empty"})
+		return
+	}
+
+	if len(req.Texts) > maxEmbedTexts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d texts can be embedded per request", maxEmbedTexts)})
+		return
+	}
+
+	for _, text := range req.Texts {
+		if strings.TrimSpace(text) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Texts cannot contain empty strings"})
+			return
+		}
+	}
+
+	vectors, model, err := h.service.EmbedTexts(c.Request.Context(), req.Texts)
+	if errors.Is(err, embeddings.ErrInputTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create embeddings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, embedResponse{
+		Model:     model,
+		Dimension: len(vectors[0]),
+		Data:      vectors,
+	})
+}
+
+func (h *EmbeddingsHandler) HandleSearch(c *gin.Context) {
+	var req searchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.Query == "" && len(req.Vector) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either query or vector is required"})
+		return
+	}
+
+	if len(req.Vector) > 0 && req.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model is required when searching by vector"})
+		return
+	}
+
+	if err := req.Filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter: " + err.Error()})
+		return
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchLimit
+	}
+
+	idx := h.service.Index()
+	docs := h.docRepo.Find(callerOf(c).filter(req.Filter))
+
+	var results []embeddings.SimilarityResult
+	var err error
+	if len(req.Vector) > 0 {
+		results, err = h.service.FindSimilarByVector(c.Request.Context(), req.Model, req.Vector, docs, req.Limit)
+	} else {
+		results, err = h.service.FindSimilarDocuments(c.Request.Context(), req.Query, docs, req.Limit)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, embeddings.ErrModelMismatch), errors.Is(err, embeddings.ErrDimensionMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search documents"})
+		}
+		return
+	}
+
+	resp := searchResponse{
+		Model:   idx.Model,
+		Metric:  idx.Metric,
+		Results: make([]searchResult, 0, len(results)),
+	}
+	for _, result := range results {
+		resp.Results = append(resp.Results, searchResult{
+			Document: result.Document,
+			Score:    result.Score,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *EmbeddingsHandler) HandleExportSnapshot(c *gin.Context) {
+	filename := fmt.Sprintf("vector-index-%s.jsonl", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	docs := h.docRepo.List()
+	if err := h.service.ExportSnapshot(c.Request.Context(), c.Writer, docs, h.chunkStore.ChunksFor(docs)); err != nil {
+		log.Printf("Failed to export vector index snapshot: %v", err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export snapshot"})
+		}
+		return
+	}
+}
+
+func (h *EmbeddingsHandler) HandleImportSnapshot(c *gin.Context) {
+	header, docs, err := h.service.ImportSnapshot(c.Request.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, embeddings.ErrMigrationInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot: " + err.Error()})
+		}
+		return
+	}
+
+	added, failed := h.service.AddSnapshotDocuments(h.docRepo, docs)
+
+	resp := gin.H{
+		"model":     header.Model,
+		"dimension": header.Dimension,
+		"options":   header.Options,
+		"documents": added,
+	}
+	if len(failed) > 0 {
+		resp["failed"] = failed
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *EmbeddingsHandler) HandleGetIndex(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Index().Info())
+}
+
+func (h *EmbeddingsHandler) HandleStartMigration(c *gin.Context) {
+	var req startMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model cannot be empty"})
+		return
+	}
+
+	metric, err := embeddings.ParseMetric(req.Metric)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := embeddings.IndexOptions{Metric: metric, Normalize: req.Normalize}
+	docs := h.docRepo.List()
+	migration, err := h.service.StartMigration(req.Model, opts, docs, h.chunkStore.ChunksFor(docs))
+	if err != nil {
+		switch {
+		case errors.Is(err, embeddings.ErrMigrationInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, migration)
+}
+
+func (h *EmbeddingsHandler) HandleGetMigration(c *gin.Context) {
+	migration, exists := h.service.MigrationStatus()
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No migration has been started"})
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
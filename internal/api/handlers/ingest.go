@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+)
+
+const maxUploadSize = 64 << 20
+
+type IngestHandler struct {
+	ingester *ingest.Ingester
+}
+
+func NewIngestHandler(ingester *ingest.Ingester) *IngestHandler {
+	return &IngestHandler{
+		ingester: ingester,
+	}
+}
+
+func (h *IngestHandler) HandleIngestUploads(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart upload"})
+		return
+	}
+
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one file must be uploaded in the files field"})
+		return
+	}
+
+	report := &ingest.Report{}
+	for _, header := range files {
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload " + header.Filename})
+			return
+		}
+
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload " + header.Filename})
+			return
+		}
+
+		h.ingester.IngestFile(report, "upload/"+header.Filename, data)
+	}
+
+	status := http.StatusOK
+	if len(report.Ingested) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
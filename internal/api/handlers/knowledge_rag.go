@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/knowledge_rag"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
 )
 
 type KnowledgeRagHandler struct {
@@ -24,12 +27,17 @@ func (h *KnowledgeRagHandler) HandleKnowledgeRagCompletion(c *gin.Context) {
 		return
 	}
 
-	if req.Message == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+	if !validateRagRequest(c, req) {
 		return
 	}
+	caller := callerOf(c)
+	req.Audience, req.Owner = caller.Audience, caller.ID
 
 	resp, err := h.service.GetCompletion(c.Request.Context(), req)
+	if errors.Is(err, knowledge_rag.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get knowledge completion"})
 		return
@@ -37,3 +45,174 @@ func (h *KnowledgeRagHandler) HandleKnowledgeRagCompletion(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// HandleExplain shows how a request would be answered: the queries, every
+// retrieval candidate and what became of it, and the prompt.
+func (h *KnowledgeRagHandler) HandleExplain(c *gin.Context) {
+	var req knowledge_rag.ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if !validateRagRequest(c, req.Request) {
+		return
+	}
+	// Explanations name documents the reader cannot see, so only admins get
+	// them; an admin can take a reader's place to see what they would get.
+	caller := callerOf(c)
+	req.Audience, req.Owner = caller.Audience, caller.ID
+	if req.AsAudience != "" {
+		audience, err := document.ParseAudience(req.AsAudience)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: as_" + err.Error()})
+			return
+		}
+		req.Audience = audience
+	}
+
+	explanation, err := h.service.Explain(c.Request.Context(), req)
+	if errors.Is(err, knowledge_rag.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to explain knowledge completion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// validateRagRequest writes a 400 response and returns false if req is
+// invalid.
+func validateRagRequest(c *gin.Context, req knowledge_rag.Request) bool {
+	if req.Message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+		return false
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// conversationTokenHeader carries the token of a conversation started
+// without an API key when reading or deleting it.
+const conversationTokenHeader = "X-Conversation-Token"
+
+func (h *KnowledgeRagHandler) HandleGetConversation(c *gin.Context) {
+	conversation, err := h.service.GetConversation(c.Param("id"), callerOf(c).ID, c.GetHeader(conversationTokenHeader))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+func (h *KnowledgeRagHandler) HandleDeleteConversation(c *gin.Context) {
+	if err := h.service.DeleteConversation(c.Param("id"), callerOf(c).ID, c.GetHeader(conversationTokenHeader)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *KnowledgeRagHandler) HandleListUnanswered(c *gin.Context) {
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"questions": h.service.UnansweredQuestions(limit)})
+}
+
+// HandleGetGaps groups low-confidence and unanswered queries into topics the
+// help articles are missing. since (RFC3339 or a date), max_confidence,
+// min_similarity and limit narrow the report.
+func (h *KnowledgeRagHandler) HandleGetGaps(c *gin.Context) {
+	opts := knowledge_rag.DefaultGapOptions()
+
+	if v := c.Query("since"); v != "" {
+		since, err := document.ParseTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 time or a date"})
+			return
+		}
+		opts.Since = since
+	}
+	if v := c.Query("max_confidence"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_confidence must be a number"})
+			return
+		}
+		opts.MaxConfidence = f
+	}
+	if v := c.Query("min_similarity"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_similarity must be a number"})
+			return
+		}
+		opts.MinSimilarity = f
+	}
+	limit, err := queryInt(c, "limit", opts.Limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+		return
+	}
+	opts.Limit = limit
+
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.service.KnowledgeGaps(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyse knowledge gaps"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleCalibrate learns the vector similarity floor for the active
+// embedding model from questions labelled with the documents that answer
+// them.
+func (h *KnowledgeRagHandler) HandleCalibrate(c *gin.Context) {
+	var req knowledge_rag.CalibrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	calibration, err := h.service.Calibrate(c.Request.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, knowledge_rag.ErrUnknownDocument), errors.Is(err, knowledge_rag.ErrNothingToCalibrate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calibrate similarity threshold"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, calibration)
+}
+
+func (h *KnowledgeRagHandler) HandleGetCalibration(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Threshold())
+}
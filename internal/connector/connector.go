@@ -0,0 +1,100 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultInterval = 5 * time.Minute
+
+// ErrUnchanged is returned by Fetch when the source reports that nothing has
+// changed since the given cursor.
+var ErrUnchanged = errors.New("source unchanged")
+
+// Item is one document in a source, identified by a source-relative path or
+// key. Err is set when the item exists but could not be turned into a
+// document; the previously synced version is then kept rather than deleted.
+type Item struct {
+	Source   string
+	Document document.Document
+	Err      error
+}
+
+// Connector lists the full contents of an external knowledge source. The
+// cursor is an opaque marker of the state last synced successfully, which
+// lets a connector return ErrUnchanged instead of re-reading everything.
+type Connector interface {
+	Name() string
+	Type() string
+	Fetch(ctx context.Context, cursor string) (items []Item, next string, err error)
+}
+
+// Watcher is implemented by connectors that can tell when their source
+// changes, so it can be synced right away instead of on the next tick.
+type Watcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// Spec configures one connector.
+type Spec struct {
+	Name     string            `yaml:"name"`
+	Type     string            `yaml:"type"`
+	Path     string            `yaml:"path"`
+	URL      string            `yaml:"url"`
+	Headers  map[string]string `yaml:"headers"`
+	Pull     bool              `yaml:"pull"`
+	Interval time.Duration     `yaml:"interval"`
+}
+
+type specFile struct {
+	Connectors []Spec `yaml:"connectors"`
+}
+
+func LoadSpecs(path string) ([]Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connector config: %w", err)
+	}
+
+	var file specFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse connector config: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, spec := range file.Connectors {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("connector %d has no name", i+1)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("duplicate connector name %q", spec.Name)
+		}
+		seen[spec.Name] = true
+
+		if spec.Interval == 0 {
+			file.Connectors[i].Interval = defaultInterval
+		} else if spec.Interval < time.Second {
+			return nil, fmt.Errorf("connector %q: interval must be at least 1s", spec.Name)
+		}
+	}
+	return file.Connectors, nil
+}
+
+func New(spec Spec) (Connector, error) {
+	switch spec.Type {
+	case "git":
+		return NewGitConnector(spec.Name, spec.Path, spec.Pull)
+	case "directory":
+		return NewDirectoryConnector(spec.Name, spec.Path)
+	case "http":
+		return NewHTTPConnector(spec.Name, spec.URL, spec.Headers)
+	default:
+		return nil, fmt.Errorf("connector %q: unknown type %q", spec.Name, spec.Type)
+	}
+}
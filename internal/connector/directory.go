@@ -0,0 +1,170 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+)
+
+// watchDebounce collapses the burst of events an editor or a copy produces
+// into a single sync.
+const watchDebounce = 500 * time.Millisecond
+
+// DirectoryConnector syncs the supported files under a directory and
+// watches it for changes.
+type DirectoryConnector struct {
+	name string
+	root string
+}
+
+func NewDirectoryConnector(name, root string) (*DirectoryConnector, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("connector %q: %w", name, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("connector %q: %s is not a directory", name, root)
+	}
+
+	return &DirectoryConnector{name: name, root: root}, nil
+}
+
+func (c *DirectoryConnector) Name() string { return c.name }
+func (c *DirectoryConnector) Type() string { return "directory" }
+
+// Fetch uses the paths, sizes and modification times of the files as its
+// cursor, so an untouched directory is not re-parsed.
+func (c *DirectoryConnector) Fetch(ctx context.Context, cursor string) ([]Item, string, error) {
+	var paths []string
+	fingerprint := sha256.New()
+
+	err := c.walk(func(path, source string, info fs.FileInfo) {
+		paths = append(paths, path)
+		fmt.Fprintf(fingerprint, "%s\x00%d\x00%d\n", source, info.Size(), info.ModTime().UnixNano())
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := hex.EncodeToString(fingerprint.Sum(nil))
+	if next == cursor {
+		return nil, cursor, ErrUnchanged
+	}
+
+	items := make([]Item, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+
+		source := c.source(path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			items = append(items, Item{Source: source, Err: err})
+			continue
+		}
+		doc, err := ingest.BuildDocument(source, data)
+		items = append(items, Item{Source: source, Document: doc, Err: err})
+	}
+
+	return items, next, nil
+}
+
+func (c *DirectoryConnector) walk(fn func(path, source string, info fs.FileInfo)) error {
+	return filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != c.root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ingest.IsSupported(path) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fn(path, c.source(path), info)
+		return nil
+	})
+}
+
+func (c *DirectoryConnector) source(path string) string {
+	rel, err := filepath.Rel(c.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Watch reports changes anywhere under the directory until ctx is done.
+// fsnotify does not recurse, so new subdirectories are added as they appear.
+func (c *DirectoryConnector) Watch(ctx context.Context, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	err = filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path != c.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", c.root, err)
+	}
+
+	var debounce *time.Timer
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+					if err := watcher.Add(event.Name); err != nil {
+						log.Printf("Connector %s: failed to watch %s: %v", c.name, event.Name, err)
+					}
+				}
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(watchDebounce, changed)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Connector %s: watch error: %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+)
+
+// GitConnector syncs the supported files committed to a local Git
+// repository, optionally pulling from its upstream first. Documents reflect
+// HEAD, so uncommitted edits are not picked up.
+type GitConnector struct {
+	name string
+	repo string
+	pull bool
+}
+
+func NewGitConnector(name, repo string, pull bool) (*GitConnector, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("connector %q: git is not installed", name)
+	}
+
+	c := &GitConnector{name: name, repo: repo, pull: pull}
+	if _, err := c.git(context.Background(), "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("connector %q: %s is not a git repository", name, repo)
+	}
+	return c, nil
+}
+
+func (c *GitConnector) Name() string { return c.name }
+func (c *GitConnector) Type() string { return "git" }
+
+// Fetch uses the HEAD commit as its cursor.
+func (c *GitConnector) Fetch(ctx context.Context, cursor string) ([]Item, string, error) {
+	if c.pull {
+		if _, err := c.git(ctx, "pull", "--ff-only", "--quiet"); err != nil {
+			return nil, "", err
+		}
+	}
+
+	out, err := c.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	head := strings.TrimSpace(string(out))
+	if head == cursor {
+		return nil, cursor, ErrUnchanged
+	}
+
+	out, err = c.git(ctx, "ls-tree", "-r", "-z", "--name-only", head)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []Item
+	for _, path := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		if path == "" || !ingest.IsSupported(path) {
+			continue
+		}
+
+		data, err := c.git(ctx, "show", head+":"+path)
+		if err != nil {
+			items = append(items, Item{Source: path, Err: err})
+			continue
+		}
+		doc, err := ingest.BuildDocument(path, data)
+		items = append(items, Item{Source: path, Document: doc, Err: err})
+	}
+
+	return items, head, nil
+}
+
+func (c *GitConnector) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", c.repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,137 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+const maxFeedSize = 64 << 20
+
+// HTTPConnector syncs a JSON feed of documents, given either as an array or
+// as an object with a "documents" array. Every entry needs an id that is
+// stable across fetches.
+type HTTPConnector struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+type feedDocument struct {
+	ID      string            `json:"id"`
+	Title   string            `json:"title"`
+	Content string            `json:"content"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+
+	Status     document.Status   `json:"status"`
+	Audience   document.Audience `json:"audience"`
+	ValidFrom  *time.Time        `json:"valid_from"`
+	ValidUntil *time.Time        `json:"valid_until"`
+}
+
+func NewHTTPConnector(name, url string, headers map[string]string) (*HTTPConnector, error) {
+	if url == "" {
+		return nil, fmt.Errorf("connector %q: url is required", name)
+	}
+
+	return &HTTPConnector{
+		name:    name,
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *HTTPConnector) Name() string { return c.name }
+func (c *HTTPConnector) Type() string { return "http" }
+
+// Fetch uses the feed's ETag as its cursor when the server sends one.
+func (c *HTTPConnector) Fetch(ctx context.Context, cursor string) ([]Item, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if cursor != "" {
+		req.Header.Set("If-None-Match", cursor)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cursor, ErrUnchanged
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read feed: %w", err)
+	}
+	if len(body) > maxFeedSize {
+		return nil, "", fmt.Errorf("feed exceeds %d bytes", maxFeedSize)
+	}
+
+	entries, err := decodeFeed(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	items := make([]Item, 0, len(entries))
+	for i, entry := range entries {
+		if entry.ID == "" {
+			return nil, "", fmt.Errorf("feed entry %d has no id", i+1)
+		}
+
+		doc := document.Document{
+			Title:   entry.Title,
+			Content: entry.Content,
+			Tags:    entry.Tags,
+			Meta:    entry.Meta,
+
+			Status:     entry.Status,
+			Audience:   entry.Audience,
+			ValidFrom:  entry.ValidFrom,
+			ValidUntil: entry.ValidUntil,
+		}
+		items = append(items, Item{Source: entry.ID, Document: doc, Err: doc.Validate()})
+	}
+
+	return items, resp.Header.Get("ETag"), nil
+}
+
+func decodeFeed(body []byte) ([]feedDocument, error) {
+	body = bytes.TrimSpace(body)
+
+	var entries []feedDocument
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, fmt.Errorf("failed to decode feed: %w", err)
+		}
+		return entries, nil
+	}
+
+	var wrapped struct {
+		Documents []feedDocument `json:"documents"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %w", err)
+	}
+	return wrapped.Documents, nil
+}
@@ -0,0 +1,302 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ingest"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+var (
+	ErrUnknownConnector = errors.New("unknown connector")
+	ErrSyncInProgress   = errors.New("sync already in progress")
+	// ErrEmptySource fails a sync whose source returned nothing while the
+	// connector still owns documents. A broken export or a misconfigured
+	// path looks just like that, and applying it would delete them all.
+	ErrEmptySource = errors.New("source returned no items")
+)
+
+type State string
+
+const (
+	StateIdle    State = "idle"
+	StateSyncing State = "syncing"
+	StateFailed  State = "failed"
+)
+
+// Status reports the outcome of a connector's most recent sync. The counts
+// cover that sync only.
+type Status struct {
+	Name          string             `json:"name"`
+	Type          string             `json:"type"`
+	State         State              `json:"state"`
+	Interval      string             `json:"interval"`
+	LastSyncAt    *time.Time         `json:"last_sync_at,omitempty"`
+	LastSuccessAt *time.Time         `json:"last_success_at,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	Added         int                `json:"added"`
+	Updated       int                `json:"updated"`
+	Deleted       int                `json:"deleted"`
+	Unchanged     int                `json:"unchanged"`
+	Failed        []ingest.FileError `json:"failed,omitempty"`
+}
+
+type runner struct {
+	connector Connector
+	interval  time.Duration
+	syncing   sync.Mutex
+
+	mu     sync.RWMutex
+	cursor string
+	status Status
+}
+
+// Manager periodically syncs each registered connector into the document
+// repository. The chunk store and embedding index follow through the
+// repository's change notifications.
+type Manager struct {
+	docRepo *document.Repository
+	runners map[string]*runner
+	mu      sync.RWMutex
+}
+
+func NewManager(docRepo *document.Repository) *Manager {
+	return &Manager{
+		docRepo: docRepo,
+		runners: make(map[string]*runner),
+	}
+}
+
+func (m *Manager) Register(c Connector, interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runners[c.Name()] = &runner{
+		connector: c,
+		interval:  interval,
+		status: Status{
+			Name:     c.Name(),
+			Type:     c.Type(),
+			State:    StateIdle,
+			Interval: interval.String(),
+		},
+	}
+}
+
+// Start syncs every connector once and then on its interval, or as soon as
+// a watching connector reports a change, until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.runners {
+		go m.run(ctx, r)
+	}
+}
+
+func (m *Manager) run(ctx context.Context, r *runner) {
+	trigger := make(chan struct{}, 1)
+	if watcher, ok := r.connector.(Watcher); ok {
+		go func() {
+			err := watcher.Watch(ctx, func() {
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				log.Printf("Connector %s: %v; falling back to periodic sync", r.connector.Name(), err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.syncing.Lock()
+		m.sync(ctx, r, false)
+		r.syncing.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-trigger:
+		}
+	}
+}
+
+// Sync runs a sync of the named connector now and returns its status.
+// confirmEmpty applies a source that returned no items, deleting every
+// document the connector owns; scheduled syncs never do.
+func (m *Manager) Sync(ctx context.Context, name string, confirmEmpty bool) (Status, error) {
+	m.mu.RLock()
+	r, exists := m.runners[name]
+	m.mu.RUnlock()
+	if !exists {
+		return Status{}, fmt.Errorf("%w: %s", ErrUnknownConnector, name)
+	}
+
+	if !r.syncing.TryLock() {
+		return Status{}, fmt.Errorf("%w: %s", ErrSyncInProgress, name)
+	}
+	defer r.syncing.Unlock()
+
+	m.sync(ctx, r, confirmEmpty)
+	return r.currentStatus(), nil
+}
+
+func (m *Manager) Statuses() []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(m.runners))
+	for _, r := range m.runners {
+		statuses = append(statuses, r.currentStatus())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// sync applies the source's current contents to the repository. The caller
+// holds r.syncing.
+func (m *Manager) sync(ctx context.Context, r *runner, confirmEmpty bool) {
+	name := r.connector.Name()
+
+	r.mu.Lock()
+	cursor := r.cursor
+	r.status.State = StateSyncing
+	r.mu.Unlock()
+
+	items, next, err := r.connector.Fetch(ctx, cursor)
+	now := time.Now()
+	if errors.Is(err, ErrUnchanged) {
+		r.mu.Lock()
+		r.status = Status{
+			Name:          name,
+			Type:          r.connector.Type(),
+			State:         StateIdle,
+			Interval:      r.interval.String(),
+			LastSyncAt:    &now,
+			LastSuccessAt: &now,
+			Unchanged:     len(m.owned(name)),
+		}
+		r.mu.Unlock()
+		return
+	}
+	if err == nil && len(items) == 0 && !confirmEmpty {
+		if owned := len(m.owned(name)); owned > 0 {
+			err = fmt.Errorf("%w but %d documents are synced from it; sync with confirm_empty=true to delete them", ErrEmptySource, owned)
+		}
+	}
+	if err != nil {
+		log.Printf("Connector %s: sync failed: %v", name, err)
+		r.mu.Lock()
+		r.status.State = StateFailed
+		r.status.LastSyncAt = &now
+		r.status.Error = err.Error()
+		r.mu.Unlock()
+		return
+	}
+
+	status := Status{
+		Name:     name,
+		Type:     r.connector.Type(),
+		State:    StateIdle,
+		Interval: r.interval.String(),
+	}
+
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		id := ingest.DocumentID(name + "/" + item.Source)
+		seen[id] = true
+
+		if item.Err != nil {
+			status.Failed = append(status.Failed, ingest.FileError{Source: item.Source, Error: item.Err.Error()})
+			continue
+		}
+
+		before, existed := m.docRepo.Get(id)
+		if _, err := m.docRepo.Add(m.prepare(name, id, item)); err != nil {
+			status.Failed = append(status.Failed, ingest.FileError{Source: item.Source, Error: err.Error()})
+			continue
+		}
+		after, _ := m.docRepo.Get(id)
+
+		switch {
+		case !existed:
+			status.Added++
+		case after.Version != before.Version:
+			status.Updated++
+		default:
+			status.Unchanged++
+		}
+	}
+
+	for _, doc := range m.owned(name) {
+		if seen[doc.ID] {
+			continue
+		}
+		if err := m.docRepo.Delete(doc.ID); err != nil && !errors.Is(err, document.ErrNotFound) {
+			status.Failed = append(status.Failed, ingest.FileError{Source: doc.Meta["source"], Error: err.Error()})
+			continue
+		}
+		status.Deleted++
+	}
+
+	finished := time.Now()
+	status.LastSyncAt = &finished
+	r.mu.Lock()
+	if len(status.Failed) == 0 {
+		// Only a clean sync advances the cursor, so failed items are
+		// retried even if the source does not change again.
+		r.cursor = next
+		status.LastSuccessAt = &finished
+	} else {
+		status.LastSuccessAt = r.status.LastSuccessAt
+		status.Error = fmt.Sprintf("%d items failed", len(status.Failed))
+	}
+	r.status = status
+	r.mu.Unlock()
+
+	if status.Added+status.Updated+status.Deleted > 0 || len(status.Failed) > 0 {
+		log.Printf("Connector %s: %d added, %d updated, %d deleted, %d failed",
+			name, status.Added, status.Updated, status.Deleted, len(status.Failed))
+	}
+}
+
+func (m *Manager) prepare(name, id string, item Item) document.Document {
+	doc := item.Document
+	doc.ID = id
+	doc.Author = "connector:" + name
+
+	meta := make(map[string]string, len(doc.Meta)+2)
+	for key, value := range doc.Meta {
+		meta[key] = value
+	}
+	meta[document.MetaConnector] = name
+	meta["source"] = item.Source
+	doc.Meta = meta
+
+	return doc
+}
+
+func (m *Manager) owned(name string) []document.Document {
+	return m.docRepo.Find(&document.Filter{Meta: map[string]string{document.MetaConnector: name}})
+}
+
+func (r *runner) currentStatus() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.status
+}
@@ -0,0 +1,395 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// Options sets when two documents count as near-duplicates. Any one signal
+// crossing its threshold is enough: MinHash catches copies with light edits,
+// SimHash catches reordered or reformatted copies, and embeddings catch
+// paraphrases. MinSimilarity <= 0 skips embeddings.
+type Options struct {
+	MinJaccard    float64 `json:"min_jaccard"`
+	MaxHamming    int     `json:"max_hamming"`
+	MinSimilarity float32 `json:"min_similarity"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinJaccard:    0.8,
+		MaxHamming:    3,
+		MinSimilarity: 0.95,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.MinJaccard <= 0 || o.MinJaccard > 1 {
+		return fmt.Errorf("min_jaccard must be in (0, 1]")
+	}
+	if o.MaxHamming < 0 || o.MaxHamming > 16 {
+		return fmt.Errorf("max_hamming must be between 0 and 16")
+	}
+	if o.MinSimilarity > 1 {
+		return fmt.Errorf("min_similarity must be at most 1")
+	}
+	return nil
+}
+
+// Member is a document in a cluster, scored against the cluster's
+// canonical document.
+type Member struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Jaccard    float64   `json:"jaccard"`
+	Hamming    int       `json:"hamming"`
+	Similarity *float32  `json:"similarity,omitempty"`
+}
+
+// Cluster groups documents linked by near-duplicate pairs. The canonical
+// document is the most recently updated one and is listed first.
+type Cluster struct {
+	Canonical string   `json:"canonical"`
+	Members   []Member `json:"members"`
+}
+
+type Report struct {
+	Options        Options   `json:"options"`
+	Documents      int       `json:"documents"`
+	Clusters       []Cluster `json:"clusters"`
+	EmbeddingError string    `json:"embedding_error,omitempty"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+type cachedSignature struct {
+	content   string
+	signature Signature
+}
+
+const (
+	// refreshDelay lets a burst of changes, such as a connector sync or a
+	// bulk import, settle into a single recomputation.
+	refreshDelay = 2 * time.Second
+
+	// retryDelay is how long a report made without embeddings is served
+	// before embedding is tried again.
+	retryDelay = time.Minute
+)
+
+// Detector finds near-duplicate documents in the repository. Signatures are
+// cached per document. The report for the default options is recomputed in
+// the background after documents change, and the last one is served in the
+// meantime, so requests never wait for detection.
+type Detector struct {
+	docRepo    *document.Repository
+	embeddings *embeddings.Service
+	opts       Options
+
+	mu         sync.Mutex
+	signatures map[string]cachedSignature
+	report     *Report
+	refresh    chan struct{}
+}
+
+func NewDetector(docRepo *document.Repository, embeddingService *embeddings.Service, opts Options) *Detector {
+	return &Detector{
+		docRepo:    docRepo,
+		embeddings: embeddingService,
+		opts:       opts,
+		signatures: make(map[string]cachedSignature),
+		refresh:    make(chan struct{}, 1),
+	}
+}
+
+func (d *Detector) Options() Options {
+	return d.opts
+}
+
+func (d *Detector) HandleDocumentChange(change document.Change) {
+	d.mu.Lock()
+	delete(d.signatures, change.Document.ID)
+	d.mu.Unlock()
+
+	d.requestRefresh()
+}
+
+// Start computes the report for the default options and then recomputes it
+// whenever documents change, until ctx is done.
+func (d *Detector) Start(ctx context.Context) {
+	d.requestRefresh()
+	go d.run(ctx)
+}
+
+func (d *Detector) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.refresh:
+		}
+
+		timer := time.NewTimer(refreshDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if report := d.recompute(ctx); report.EmbeddingError != "" {
+			time.AfterFunc(retryDelay, d.requestRefresh)
+		}
+	}
+}
+
+func (d *Detector) requestRefresh() {
+	select {
+	case d.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Detector) recompute(ctx context.Context) *Report {
+	report := d.Detect(ctx, d.opts)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.report = report
+	return report
+}
+
+// Report returns the latest clusters for the default options. It only
+// detects them on the spot before the first background run has finished.
+func (d *Detector) Report(ctx context.Context) *Report {
+	d.mu.Lock()
+	report := d.report
+	d.mu.Unlock()
+	if report != nil {
+		return report
+	}
+	return d.recompute(ctx)
+}
+
+// Canonicals maps every document that has a near-duplicate to the
+// canonical document of its cluster, as of the latest report. Until the
+// first report is ready it is empty rather than waiting for detection.
+func (d *Detector) Canonicals() map[string]string {
+	d.mu.Lock()
+	report := d.report
+	d.mu.Unlock()
+
+	canonicals := make(map[string]string)
+	if report == nil {
+		return canonicals
+	}
+	for _, cluster := range report.Clusters {
+		for _, member := range cluster.Members {
+			canonicals[member.ID] = cluster.Canonical
+		}
+	}
+	return canonicals
+}
+
+// Detect clusters the repository's documents with opts. If embeddings are
+// unavailable the text signals alone are used and the error is reported.
+func (d *Detector) Detect(ctx context.Context, opts Options) *Report {
+	docs := d.docRepo.List()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+
+	report := &Report{Options: opts, Documents: len(docs), Clusters: []Cluster{}}
+
+	signatures := make([]Signature, len(docs))
+	for i, doc := range docs {
+		signatures[i] = d.signature(doc)
+	}
+
+	var idx *embeddings.Index
+	var vectors [][]float32
+	if opts.MinSimilarity > 0 && len(docs) > 1 {
+		var err error
+		idx, vectors, err = d.embeddings.DocumentEmbeddings(ctx, docs)
+		if err != nil {
+			log.Printf("Duplicate detection without embeddings: %v", err)
+			report.EmbeddingError = err.Error()
+			vectors = nil
+		}
+	}
+
+	compare := func(i, j int) Member {
+		m := Member{
+			ID:        docs[j].ID,
+			Title:     docs[j].Title,
+			UpdatedAt: docs[j].UpdatedAt,
+			Jaccard:   signatures[i].Jaccard(signatures[j]),
+			Hamming:   signatures[i].Hamming(signatures[j]),
+		}
+		if vectors != nil {
+			if score, err := idx.Score(vectors[i], vectors[j]); err == nil {
+				m.Similarity = &score
+			}
+		}
+		return m
+	}
+	duplicate := func(m Member) bool {
+		return m.Jaccard >= opts.MinJaccard ||
+			m.Hamming <= opts.MaxHamming ||
+			(m.Similarity != nil && *m.Similarity >= opts.MinSimilarity)
+	}
+
+	parent := make([]int, len(docs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	var vectorBuckets [][hyperplaneTables]uint64
+	if vectors != nil {
+		vectorBuckets = hyperplaneBuckets(vectors, hyperplaneBits(cosineFloor(idx.Metric, opts.MinSimilarity)))
+	}
+
+	for _, pair := range candidatePairs(signatures, opts.MaxHamming, vectorBuckets) {
+		if duplicate(compare(pair[0], pair[1])) {
+			parent[find(pair[0])] = find(pair[1])
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range docs {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		canonical := group[0]
+		for _, i := range group[1:] {
+			if docs[i].UpdatedAt.After(docs[canonical].UpdatedAt) {
+				canonical = i
+			}
+		}
+
+		cluster := Cluster{Canonical: docs[canonical].ID}
+		for _, i := range group {
+			cluster.Members = append(cluster.Members, compare(canonical, i))
+		}
+		sort.SliceStable(cluster.Members, func(a, b int) bool {
+			if cluster.Members[a].ID == cluster.Canonical {
+				return true
+			}
+			if cluster.Members[b].ID == cluster.Canonical {
+				return false
+			}
+			return cluster.Members[a].Jaccard > cluster.Members[b].Jaccard
+		})
+		report.Clusters = append(report.Clusters, cluster)
+	}
+
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		if len(report.Clusters[i].Members) != len(report.Clusters[j].Members) {
+			return len(report.Clusters[i].Members) > len(report.Clusters[j].Members)
+		}
+		return report.Clusters[i].Canonical < report.Clusters[j].Canonical
+	})
+
+	report.GeneratedAt = time.Now()
+	return report
+}
+
+func (d *Detector) signature(doc document.Document) Signature {
+	text := doc.Title + "\n" + doc.Content
+
+	d.mu.Lock()
+	cached, exists := d.signatures[doc.ID]
+	d.mu.Unlock()
+	if exists && cached.content == text {
+		return cached.signature
+	}
+
+	sig := NewSignature(text)
+
+	d.mu.Lock()
+	d.signatures[doc.ID] = cachedSignature{content: text, signature: sig}
+	d.mu.Unlock()
+	return sig
+}
+
+// candidatePairs returns the index pairs worth comparing: pairs sharing a
+// MinHash band, a SimHash block, which by the pigeonhole principle every
+// pair within maxHamming bits does when the hash is split into
+// maxHamming+1 blocks, or, with embeddings, a hyperplane bucket.
+func candidatePairs(signatures []Signature, maxHamming int, vectorBuckets [][hyperplaneTables]uint64) [][2]int {
+	var pairs [][2]int
+
+	type bucketKey struct {
+		kind  int
+		index int
+		value uint64
+	}
+	buckets := make(map[bucketKey][]int)
+	blocks := maxHamming + 1
+	for i, sig := range signatures {
+		// Texts without terms share every band and block, so only their
+		// embeddings, if any, can make them candidates.
+		if sig.empty {
+			continue
+		}
+		for b, value := range sig.bands() {
+			key := bucketKey{0, b, value}
+			buckets[key] = append(buckets[key], i)
+		}
+		for b := 0; b < blocks; b++ {
+			lo, hi := 64*b/blocks, 64*(b+1)/blocks
+			mask := uint64(1)<<(hi-lo) - 1
+			if hi-lo == 64 {
+				mask = ^uint64(0)
+			}
+			key := bucketKey{1, b, (sig.SimHash >> lo) & mask}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+	for i, tables := range vectorBuckets {
+		for t, value := range tables {
+			if value != 0 {
+				key := bucketKey{2, t, value}
+				buckets[key] = append(buckets[key], i)
+			}
+		}
+	}
+
+	seen := make(map[[2]int]bool)
+	for _, members := range buckets {
+		for a := 0; a < len(members); a++ {
+			for b := a + 1; b < len(members); b++ {
+				pair := [2]int{members[a], members[b]}
+				if !seen[pair] {
+					seen[pair] = true
+					pairs = append(pairs, pair)
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
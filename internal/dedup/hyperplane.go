@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/ai/embeddings"
+)
+
+const (
+	// hyperplaneTables is how many independent hyperplane hashes a pair of
+	// vectors gets to share a bucket in.
+	hyperplaneTables = 24
+
+	// hyperplaneHitRate is the chance that a pair right at the similarity
+	// threshold shares one table's bucket. Over 24 tables such a pair is
+	// missed with probability 0.7^24, about once in 5000; closer pairs are
+	// missed far less often.
+	hyperplaneHitRate = 0.3
+
+	maxHyperplaneBits = 16
+)
+
+// hyperplaneBits is how many random hyperplanes each table hashes with. A
+// hyperplane separates two vectors at angle θ with probability θ/π, so with
+// k of them a pair at the threshold shares a bucket with probability
+// (1-θ/π)^k; k is the largest that keeps that at hyperplaneHitRate.
+func hyperplaneBits(minCosine float64) int {
+	separated := math.Acos(max(-1, min(1, minCosine))) / math.Pi
+	if separated <= 0 {
+		return maxHyperplaneBits
+	}
+	if separated >= 1 {
+		return 1
+	}
+	k := int(math.Log(hyperplaneHitRate) / math.Log(1-separated))
+	return min(max(k, 1), maxHyperplaneBits)
+}
+
+// cosineFloor converts an embedding similarity threshold under metric to
+// the cosine similarity it implies. OpenAI embeddings have unit length, so
+// the dot product is the cosine and the Euclidean distance d, scored as
+// 1/(1+d), is sqrt(2 - 2cos).
+func cosineFloor(metric embeddings.Metric, minSimilarity float32) float64 {
+	if metric != embeddings.MetricEuclidean {
+		return float64(minSimilarity)
+	}
+	d := 1/float64(minSimilarity) - 1
+	return 1 - d*d/2
+}
+
+// hyperplaneBuckets hashes every vector into hyperplaneTables buckets of
+// bits random hyperplanes each. Vectors pointing the same way fall on the
+// same side of most hyperplanes, so near-duplicates share a bucket in at
+// least one table while unrelated vectors rarely do. Vectors without the
+// expected dimension, such as missing ones, get no buckets.
+func hyperplaneBuckets(vectors [][]float32, bits int) [][hyperplaneTables]uint64 {
+	dim := 0
+	for _, v := range vectors {
+		if len(v) > 0 {
+			dim = len(v)
+			break
+		}
+	}
+
+	// A fixed seed keeps the buckets, and so the report, the same between
+	// runs over the same vectors.
+	rng := rand.New(rand.NewSource(2))
+	planes := make([][]float32, hyperplaneTables*bits)
+	for i := range planes {
+		planes[i] = make([]float32, dim)
+		for j := range planes[i] {
+			planes[i][j] = float32(rng.NormFloat64())
+		}
+	}
+
+	buckets := make([][hyperplaneTables]uint64, len(vectors))
+	for i, v := range vectors {
+		if dim == 0 || len(v) != dim {
+			continue
+		}
+		for t := 0; t < hyperplaneTables; t++ {
+			// The bucket is stored one above the sign bits so that zero
+			// stays free to mean no bucket.
+			key := uint64(1)
+			for b := 0; b < bits; b++ {
+				key <<= 1
+				if dot(planes[t*bits+b], v) >= 0 {
+					key |= 1
+				}
+			}
+			buckets[i][t] = key
+		}
+	}
+	return buckets
+}
+
+func dot(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
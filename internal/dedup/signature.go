@@ -0,0 +1,158 @@
+package dedup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
+)
+
+const (
+	shingleSize = 3
+
+	minHashSize = 128
+	lshBands    = 32
+	lshRows     = minHashSize / lshBands
+
+	// mersennePrime is 2^61-1, the modulus of the MinHash permutations.
+	mersennePrime = (1 << 61) - 1
+)
+
+// permutations are the (a, b) pairs of the universal hash functions
+// h(x) = (a*x + b) mod p. The seed is fixed so signatures stay comparable
+// across restarts.
+var permutations = func() [minHashSize][2]uint64 {
+	rng := rand.New(rand.NewSource(1))
+	var p [minHashSize][2]uint64
+	for i := range p {
+		p[i] = [2]uint64{uint64(rng.Int63n(mersennePrime-1)) + 1, uint64(rng.Int63n(mersennePrime))}
+	}
+	return p
+}()
+
+// Signature summarises a text for near-duplicate detection. MinHash
+// estimates the Jaccard similarity of the texts' word shingles; SimHash
+// fingerprints the weighted term distribution so that texts with a small
+// Hamming distance are near-identical.
+type Signature struct {
+	MinHash [minHashSize]uint64
+	SimHash uint64
+	empty   bool
+}
+
+func NewSignature(text string) Signature {
+	terms := search.Terms(text)
+	shingles := shingle(terms)
+
+	sig := Signature{empty: len(shingles) == 0}
+	for i := range sig.MinHash {
+		sig.MinHash[i] = mersennePrime
+	}
+	for _, s := range shingles {
+		x := hash64(s) % mersennePrime
+		for i, p := range permutations {
+			if h := mulMod(p[0], x, p[1]); h < sig.MinHash[i] {
+				sig.MinHash[i] = h
+			}
+		}
+	}
+
+	var weights [64]int
+	for _, term := range terms {
+		h := hash64(term)
+		for bit := 0; bit < 64; bit++ {
+			if h&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, w := range weights {
+		if w > 0 {
+			sig.SimHash |= 1 << bit
+		}
+	}
+
+	return sig
+}
+
+// Jaccard estimates the Jaccard similarity of the two texts' shingle sets.
+func (s Signature) Jaccard(other Signature) float64 {
+	if s.empty || other.empty {
+		return 0
+	}
+	equal := 0
+	for i := range s.MinHash {
+		if s.MinHash[i] == other.MinHash[i] {
+			equal++
+		}
+	}
+	return float64(equal) / minHashSize
+}
+
+// Hamming is the number of differing SimHash bits. A text without terms
+// has no fingerprint, only a SimHash of zero, so it is reported as
+// differing in every bit rather than matching every other such text.
+func (s Signature) Hamming(other Signature) int {
+	if s.empty || other.empty {
+		return 64
+	}
+	return bits.OnesCount64(s.SimHash ^ other.SimHash)
+}
+
+// bands splits the MinHash into LSH bands. Texts sharing any band are
+// candidate duplicates; with 32 bands of 4 rows a pair with Jaccard 0.8 is
+// a candidate with probability above 0.999.
+func (s Signature) bands() [lshBands]uint64 {
+	var bands [lshBands]uint64
+	for b := range bands {
+		h := fnv.New64a()
+		for _, v := range s.MinHash[b*lshRows : (b+1)*lshRows] {
+			var buf [8]byte
+			for i := range buf {
+				buf[i] = byte(v >> (8 * i))
+			}
+			h.Write(buf[:])
+		}
+		bands[b] = h.Sum64()
+	}
+	return bands
+}
+
+func shingle(terms []string) []string {
+	if len(terms) < shingleSize {
+		if len(terms) == 0 {
+			return nil
+		}
+		return []string{strings.Join(terms, " ")}
+	}
+
+	shingles := make([]string, 0, len(terms)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(terms); i++ {
+		shingles = append(shingles, strings.Join(terms[i:i+shingleSize], " "))
+	}
+	return shingles
+}
+
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mulMod returns (a*x + b) mod 2^61-1 without overflow.
+func mulMod(a, x, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, x)
+	// a*x = hi*2^64 + lo, and 2^64 = 8 mod p, 2^61 = 1 mod p.
+	r := (lo & mersennePrime) + (lo >> 61) + (hi << 3)
+	r = (r & mersennePrime) + (r >> 61)
+	r += b
+	r = (r & mersennePrime) + (r >> 61)
+	if r >= mersennePrime {
+		r -= mersennePrime
+	}
+	return r
+}
@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Blockquote: true, atom.Pre: true,
+}
+
+// parseHTML takes the title from <title> (or the first <h1>), tags from the
+// keywords meta tag and any other named meta tags into Meta. Scripts, styles
+// and navigation chrome are dropped from the text.
+func parseHTML(data []byte) (Parsed, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return Parsed{}, fmt.Errorf("invalid html: %w", err)
+	}
+
+	parsed := Parsed{}
+	var heading string
+	var text strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Nav, atom.Header, atom.Footer:
+				return
+			case atom.Title:
+				parsed.Title = strings.TrimSpace(nodeText(n))
+				return
+			case atom.Meta:
+				applyMetaTag(&parsed, n)
+				return
+			case atom.H1:
+				if heading == "" {
+					heading = strings.TrimSpace(nodeText(n))
+				}
+			}
+		}
+
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if n.Type == html.ElementNode && blockElements[n.DataAtom] {
+			text.WriteString("\n")
+		}
+	}
+	walk(root)
+
+	if parsed.Title == "" {
+		parsed.Title = heading
+	}
+	parsed.Content = collapseWhitespace(text.String())
+
+	return parsed, nil
+}
+
+func applyMetaTag(parsed *Parsed, n *html.Node) {
+	var name, content string
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "name", "property":
+			name = strings.ToLower(attr.Val)
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+
+	if name == "" || content == "" {
+		return
+	}
+
+	if name == "keywords" {
+		parsed.Tags = append(parsed.Tags, toStrings(content)...)
+		return
+	}
+
+	if parsed.Meta == nil {
+		parsed.Meta = make(map[string]string)
+	}
+	parsed.Meta[name] = content
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// collapseWhitespace squeezes runs of spaces within lines and drops blank
+// lines, keeping one line per block element.
+func collapseWhitespace(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,192 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+const maxFileSize = 20 << 20
+
+type Ingester struct {
+	docRepo *document.Repository
+}
+
+func NewIngester(docRepo *document.Repository) *Ingester {
+	return &Ingester{
+		docRepo: docRepo,
+	}
+}
+
+type FileError struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+type Report struct {
+	Ingested []string    `json:"ingested"`
+	Skipped  []string    `json:"skipped,omitempty"`
+	Failed   []FileError `json:"failed,omitempty"`
+}
+
+// IngestDir walks root and upserts every supported file. Sources are
+// recorded relative to root so re-running against the same tree updates
+// documents in place instead of duplicating them.
+func (i *Ingester) IngestDir(root string) (*Report, error) {
+	report := &Report{}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		source := filepath.ToSlash(rel)
+
+		if !IsSupported(path) {
+			report.Skipped = append(report.Skipped, source)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			report.fail(source, err)
+			return nil
+		}
+		if info.Size() > maxFileSize {
+			report.fail(source, fmt.Errorf("file exceeds %d bytes", maxFileSize))
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			report.fail(source, err)
+			return nil
+		}
+
+		i.ingest(report, source, data)
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	return report, nil
+}
+
+// IngestFile upserts a single file, such as an upload, identified by source.
+func (i *Ingester) IngestFile(report *Report, source string, data []byte) {
+	if !IsSupported(source) {
+		report.Skipped = append(report.Skipped, source)
+		return
+	}
+	if len(data) > maxFileSize {
+		report.fail(source, fmt.Errorf("file exceeds %d bytes", maxFileSize))
+		return
+	}
+
+	i.ingest(report, source, data)
+}
+
+func (i *Ingester) ingest(report *Report, source string, data []byte) {
+	doc, err := BuildDocument(source, data)
+	if err != nil {
+		report.fail(source, err)
+		return
+	}
+
+	id, err := i.docRepo.Add(doc)
+	if err != nil {
+		report.fail(source, err)
+		return
+	}
+
+	report.Ingested = append(report.Ingested, id)
+}
+
+// BuildDocument parses data and returns a validated document whose ID is
+// derived from source.
+func BuildDocument(source string, data []byte) (document.Document, error) {
+	parsed, err := Parse(source, data)
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	meta := parsed.Meta
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	meta["source"] = source
+	// Only a connector may claim the document, after building it.
+	delete(meta, document.MetaConnector)
+
+	doc := document.Document{
+		ID:      DocumentID(source),
+		Title:   parsed.Title,
+		Content: parsed.Content,
+		Tags:    parsed.Tags,
+		Meta:    meta,
+		Author:  "ingest",
+	}
+	if err := applyVisibility(&doc); err != nil {
+		return document.Document{}, err
+	}
+	if err := doc.Validate(); err != nil {
+		return document.Document{}, err
+	}
+
+	return doc, nil
+}
+
+// applyVisibility moves the status, audience and validity window from
+// front matter or meta tags into their document fields.
+func applyVisibility(doc *document.Document) error {
+	doc.Status = document.Status(doc.Meta["status"])
+	doc.Audience = document.Audience(doc.Meta["audience"])
+
+	for key, field := range map[string]**time.Time{
+		"valid_from":  &doc.ValidFrom,
+		"valid_until": &doc.ValidUntil,
+	} {
+		value, exists := doc.Meta[key]
+		if !exists {
+			continue
+		}
+		t, err := document.ParseTime(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*field = &t
+	}
+
+	for _, key := range []string{"status", "audience", "valid_from", "valid_until"} {
+		delete(doc.Meta, key)
+	}
+	return nil
+}
+
+// DocumentID derives a stable ID from a source path.
+func DocumentID(source string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(source)))
+	return "src_" + hex.EncodeToString(sum[:8])
+}
+
+func (r *Report) fail(source string, err error) {
+	r.Failed = append(r.Failed, FileError{Source: source, Error: err.Error()})
+}
@@ -0,0 +1,173 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// Parsed is the text and metadata extracted from one source file.
+type Parsed struct {
+	Title   string
+	Content string
+	Tags    []string
+	Meta    map[string]string
+}
+
+type parser func(data []byte) (Parsed, error)
+
+var parsers = map[string]parser{
+	".md":       parseMarkdown,
+	".markdown": parseMarkdown,
+	".txt":      parseText,
+	".html":     parseHTML,
+	".htm":      parseHTML,
+	".pdf":      parsePDF,
+}
+
+func IsSupported(name string) bool {
+	_, ok := parsers[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Parse picks a parser from the file extension of name. When the file does
+// not name its own title, the file name without extension is used.
+func Parse(name string, data []byte) (Parsed, error) {
+	parse, ok := parsers[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return Parsed{}, fmt.Errorf("%w: %s", ErrUnsupportedFormat, filepath.Ext(name))
+	}
+
+	parsed, err := parse(data)
+	if err != nil {
+		return Parsed{}, err
+	}
+
+	if parsed.Title == "" {
+		parsed.Title = titleFromFileName(name)
+	}
+	parsed.Content = strings.TrimSpace(parsed.Content)
+
+	return parsed, nil
+}
+
+func parseText(data []byte) (Parsed, error) {
+	return Parsed{Content: string(data)}, nil
+}
+
+// parseMarkdown reads optional YAML front matter delimited by "---" lines.
+// title and tags map to the document fields, every other scalar key ends up
+// in Meta. Without a front matter title the first level-one heading is used.
+func parseMarkdown(data []byte) (Parsed, error) {
+	parsed := Parsed{}
+	body := data
+
+	if frontMatter, rest, ok := splitFrontMatter(data); ok {
+		var fields map[string]interface{}
+		if err := yaml.Unmarshal(frontMatter, &fields); err != nil {
+			return Parsed{}, fmt.Errorf("invalid front matter: %w", err)
+		}
+		applyFrontMatter(&parsed, fields)
+		body = rest
+	}
+
+	if parsed.Title == "" {
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.HasPrefix(line, "# ") {
+				parsed.Title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+				break
+			}
+		}
+	}
+
+	parsed.Content = string(body)
+	return parsed, nil
+}
+
+func splitFrontMatter(data []byte) ([]byte, []byte, bool) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if !bytes.HasPrefix(data, []byte("---\n")) && !bytes.HasPrefix(data, []byte("---\r\n")) {
+		return nil, nil, false
+	}
+
+	start := bytes.IndexByte(data, '\n') + 1
+	for offset := start; offset < len(data); {
+		end := bytes.IndexByte(data[offset:], '\n')
+		line := data[offset:]
+		next := len(data)
+		if end >= 0 {
+			line = data[offset : offset+end]
+			next = offset + end + 1
+		}
+
+		if strings.TrimSpace(string(line)) == "---" {
+			return data[start:offset], data[next:], true
+		}
+		offset = next
+	}
+
+	return nil, nil, false
+}
+
+func applyFrontMatter(parsed *Parsed, fields map[string]interface{}) {
+	for key, value := range fields {
+		switch strings.ToLower(key) {
+		case "title":
+			parsed.Title = fmt.Sprint(value)
+		case "tags":
+			parsed.Tags = append(parsed.Tags, toStrings(value)...)
+		default:
+			if _, nested := value.(map[string]interface{}); nested {
+				continue
+			}
+			if parsed.Meta == nil {
+				parsed.Meta = make(map[string]string)
+			}
+			parsed.Meta[key] = strings.Join(toStrings(value), ",")
+		}
+	}
+}
+
+func toStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case time.Time:
+		return []string{v.Format(time.RFC3339)}
+	case string:
+		var out []string
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+		return out
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func titleFromFileName(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	base = strings.NewReplacer("-", " ", "_", " ").Replace(base)
+	if base == "" {
+		return base
+	}
+	first, size := utf8.DecodeRuneInString(base)
+	return string(unicode.ToUpper(first)) + base[size:]
+}
@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// parsePDF extracts the plain text layer and the Title entry of the document
+// information dictionary. Scanned PDFs without a text layer come back empty
+// and are rejected by document validation. The pdf package panics on some
+// malformed files, so a panic is turned into an error for that file alone.
+func parsePDF(data []byte) (parsed Parsed, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			parsed, err = Parsed{}, fmt.Errorf("invalid pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Parsed{}, fmt.Errorf("invalid pdf: %w", err)
+	}
+
+	textReader, err := reader.GetPlainText()
+	if err != nil {
+		return Parsed{}, fmt.Errorf("failed to extract pdf text: %w", err)
+	}
+
+	text, err := io.ReadAll(textReader)
+	if err != nil {
+		return Parsed{}, fmt.Errorf("failed to extract pdf text: %w", err)
+	}
+
+	parsed = Parsed{Content: string(text)}
+
+	info := reader.Trailer().Key("Info")
+	if title := strings.TrimSpace(info.Key("Title").Text()); title != "" {
+		parsed.Title = title
+	}
+	if keywords := strings.TrimSpace(info.Key("Keywords").Text()); keywords != "" {
+		parsed.Tags = toStrings(keywords)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,186 @@
+package pii
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Action string
+
+const (
+	ActionMask   Action = "mask"
+	ActionReject Action = "reject"
+)
+
+// Rule finds one kind of PII. A match only counts when Validate, if set,
+// accepts it, which keeps digit patterns like card numbers from firing on
+// arbitrary numbers.
+type Rule struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+	Action   Action
+	// Replacement is what a masked match becomes; it defaults to the
+	// upper-cased rule name in brackets, e.g. [EMAIL].
+	Replacement string
+}
+
+var validators = map[string]func(string) bool{
+	"luhn":  luhn,
+	"iban":  iban,
+	"ssn":   ssn,
+	"phone": phone,
+}
+
+// DefaultRules are applied in order, so more specific patterns claim their
+// matches before the broad phone pattern sees them.
+func DefaultRules(action Action) []Rule {
+	return []Rule{
+		{Name: "email", Pattern: regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`), Action: action},
+		{Name: "iban", Pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`), Validate: iban, Action: action},
+		{Name: "card", Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Validate: luhn, Action: action},
+		{Name: "ssn", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), Validate: ssn, Action: action},
+		{Name: "order_id", Pattern: regexp.MustCompile(`(?i)\b(?:ORD|ORDER)[-#: ]?\d{6,}\b`), Action: action},
+		{Name: "phone", Pattern: regexp.MustCompile(`(?:\+|\b)\d[\d ().-]{8,}\d\b`), Validate: phone, Action: action},
+	}
+}
+
+type ruleSpec struct {
+	Name        string `yaml:"name"`
+	Pattern     string `yaml:"pattern"`
+	Validator   string `yaml:"validator"`
+	Action      Action `yaml:"action"`
+	Replacement string `yaml:"replacement"`
+}
+
+// LoadRules reads rules from a YAML file with a top-level "rules" list.
+// Rules without an action use defaultAction.
+func LoadRules(path string, defaultAction Action) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PII rules: %w", err)
+	}
+
+	var file struct {
+		Rules []ruleSpec `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse PII rules: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	for i, spec := range file.Rules {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("PII rule %d has no name", i+1)
+		}
+
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("PII rule %q: invalid pattern: %w", spec.Name, err)
+		}
+
+		rule := Rule{Name: spec.Name, Pattern: pattern, Action: spec.Action, Replacement: spec.Replacement}
+		if rule.Action == "" {
+			rule.Action = defaultAction
+		}
+		if rule.Action != ActionMask && rule.Action != ActionReject {
+			return nil, fmt.Errorf("PII rule %q: action must be mask or reject", spec.Name)
+		}
+		if spec.Validator != "" {
+			validate, ok := validators[spec.Validator]
+			if !ok {
+				return nil, fmt.Errorf("PII rule %q: unknown validator %q", spec.Name, spec.Validator)
+			}
+			rule.Validate = validate
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r Rule) replacement() string {
+	if r.Replacement != "" {
+		return r.Replacement
+	}
+	return "[" + strings.ToUpper(r.Name) + "]"
+}
+
+func digits(s string) []int {
+	var out []int
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			out = append(out, int(r-'0'))
+		}
+	}
+	return out
+}
+
+// luhn validates payment card numbers.
+func luhn(s string) bool {
+	d := digits(s)
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		n := d[i]
+		if (len(d)-1-i)%2 == 1 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// iban checks the ISO 13616 mod-97 checksum.
+func iban(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+
+	rearranged := s[4:] + s[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// ssn rejects the area, group and serial numbers the SSA never issues. As
+// custom rules can use it with any pattern, it accepts only the dashed form
+// or nine bare digits and rejects everything else.
+func ssn(s string) bool {
+	if len(s) == 11 && s[3] == '-' && s[6] == '-' {
+		s = s[0:3] + s[4:6] + s[7:11]
+	}
+	if len(s) != 9 || strings.Trim(s, "0123456789") != "" {
+		return false
+	}
+	area, group, serial := s[0:3], s[3:5], s[5:9]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// phone accepts 10 to 15 digits, the E.164 range for numbers that include
+// an area code.
+func phone(s string) bool {
+	n := len(digits(s))
+	return n >= 10 && n <= 15
+}
@@ -0,0 +1,137 @@
+package pii
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/document"
+)
+
+// MetaRedacted records on a document which kinds of PII were masked and how
+// often, e.g. "email:2,phone:1". The values themselves are never kept.
+const MetaRedacted = "pii_redacted"
+
+// Scrubber masks or rejects PII in documents before they are stored, so it
+// never reaches the embedding index or a model provider.
+type Scrubber struct {
+	rules []Rule
+}
+
+func NewScrubber(rules []Rule) *Scrubber {
+	return &Scrubber{rules: rules}
+}
+
+// Configure builds a scrubber from the PII_ACTION and PII_RULES settings:
+// the default rules with action, or the rules in rulesPath when set. It
+// returns nil when action is "off".
+func Configure(action, rulesPath string) (*Scrubber, error) {
+	switch Action(action) {
+	case "off":
+		log.Printf("PII scrubbing is disabled")
+		return nil, nil
+	case ActionMask, ActionReject:
+	default:
+		return nil, fmt.Errorf("unknown PII action %q", action)
+	}
+
+	if rulesPath == "" {
+		return NewScrubber(DefaultRules(Action(action))), nil
+	}
+
+	rules, err := LoadRules(rulesPath, Action(action))
+	if err != nil {
+		return nil, err
+	}
+	return NewScrubber(rules), nil
+}
+
+// Sanitize implements document.Sanitizer. It scans the title, content, tags
+// and meta values, and fails with document.ErrRejected if a reject rule
+// matches.
+func (s *Scrubber) Sanitize(doc document.Document) (document.Document, error) {
+	counts := make(map[string]int)
+	var rejected []string
+
+	scrub := func(text string) string {
+		for _, rule := range s.rules {
+			text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+				if rule.Validate != nil && !rule.Validate(match) {
+					return match
+				}
+				if rule.Action == ActionReject {
+					rejected = append(rejected, rule.Name)
+					return match
+				}
+				counts[rule.Name]++
+				return rule.replacement()
+			})
+		}
+		return text
+	}
+
+	doc.Title = scrub(doc.Title)
+	doc.Content = scrub(doc.Content)
+	if len(doc.Tags) > 0 {
+		tags := make([]string, len(doc.Tags))
+		for i, tag := range doc.Tags {
+			tags[i] = scrub(tag)
+		}
+		doc.Tags = tags
+	}
+	if len(doc.Meta) > 0 {
+		meta := make(map[string]string, len(doc.Meta))
+		for key, value := range doc.Meta {
+			// The redaction summary is the scrubber's own to set; a value
+			// sent by the caller would claim a masking that never happened.
+			if key == MetaRedacted {
+				continue
+			}
+			meta[key] = scrub(value)
+		}
+		doc.Meta = meta
+	}
+
+	if len(rejected) > 0 {
+		log.Printf("PII: rejected document %s: contains %s", doc.ID, strings.Join(unique(rejected), ", "))
+		return document.Document{}, fmt.Errorf("%w: contains %s", document.ErrRejected, strings.Join(unique(rejected), ", "))
+	}
+
+	if len(counts) > 0 {
+		summary := summarize(counts)
+		log.Printf("PII: masked in document %s: %s", doc.ID, summary)
+		if doc.Meta == nil {
+			doc.Meta = make(map[string]string)
+		}
+		doc.Meta[MetaRedacted] = summary
+	}
+
+	return doc, nil
+}
+
+func summarize(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s:%d", name, counts[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+func unique(names []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+)
+
+// Token is an analyzed term together with the byte range of the word it
+// came from, so matches can be highlighted in the original text.
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Analyze splits text into lowercase words, drops English stop words and
+// reduces the rest to their Snowball stems, so "Resetting passwords" and
+// "reset password" produce the same terms.
+func Analyze(text string) []Token {
+	var tokens []Token
+
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		wordStart := start
+		word := strings.ToLower(text[start:end])
+		start = -1
+
+		if len(word) < 2 && !isDigits(word) {
+			return
+		}
+		if english.IsStopWord(word) {
+			return
+		}
+		tokens = append(tokens, Token{Term: english.Stem(word, false), Start: wordStart, End: end})
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || (r == '\'' && start >= 0) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+
+	return tokens
+}
+
+func Terms(text string) []string {
+	tokens := Analyze(text)
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.Term
+	}
+	return terms
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,146 @@
+package search
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an inverted index scored with Okapi BM25.
+type Index struct {
+	postings map[string]map[string]int
+	docTerms map[string][]string
+	lengths  map[string]int
+	totalLen int
+	mu       sync.RWMutex
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]int),
+		docTerms: make(map[string][]string),
+		lengths:  make(map[string]int),
+	}
+}
+
+// Put indexes text under id, replacing whatever id held before.
+func (idx *Index) Put(id string, text string) {
+	terms := Terms(text)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+
+	for _, term := range terms {
+		docs, exists := idx.postings[term]
+		if !exists {
+			docs = make(map[string]int)
+			idx.postings[term] = docs
+		}
+		docs[id]++
+	}
+	idx.docTerms[id] = uniqueTerms(terms)
+	idx.lengths[id] = len(terms)
+	idx.totalLen += len(terms)
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	length, exists := idx.lengths[id]
+	if !exists {
+		return
+	}
+
+	for _, term := range idx.docTerms[id] {
+		docs := idx.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docTerms, id)
+	delete(idx.lengths, id)
+	idx.totalLen -= length
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.lengths)
+}
+
+// Search returns the ids matching at least one query term, best first.
+// accept, when not nil, limits results to the ids it returns true for;
+// limit <= 0 returns every match.
+func (idx *Index) Search(query string, limit int, accept func(id string) bool) []Hit {
+	terms := uniqueTerms(Terms(query))
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.lengths))
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(idx.totalLen) / n
+
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		docs := idx.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, tf := range docs {
+			if accept != nil && !accept(id) {
+				continue
+			}
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(idx.lengths[id])/avgLen)
+			scores[id] += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+
+	sortHits(hits)
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	unique := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
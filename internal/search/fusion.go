@@ -0,0 +1,67 @@
+package search
+
+import "sort"
+
+// rrfK damps the advantage of the very top ranks in reciprocal rank fusion;
+// 60 is the value from the original paper and works well in practice.
+const rrfK = 60
+
+// FuseRRF merges ranked lists with weighted reciprocal rank fusion: every
+// list adds weight/(60+rank) to each id it contains. Only ranks matter, so
+// lists with incomparable scores, like BM25 and cosine similarity, can be
+// mixed.
+func FuseRRF(lists [][]Hit, weights []float64) []Hit {
+	scores := make(map[string]float64)
+	for i, list := range lists {
+		for rank, hit := range list {
+			scores[hit.ID] += weights[i] / float64(rrfK+rank+1)
+		}
+	}
+	return sortedHits(scores)
+}
+
+// FuseWeighted merges lists by a weighted sum of their scores after
+// min-max normalising each list to [0, 1]. An id missing from a list gets
+// nothing from it.
+func FuseWeighted(lists [][]Hit, weights []float64) []Hit {
+	scores := make(map[string]float64)
+	for i, list := range lists {
+		if len(list) == 0 {
+			continue
+		}
+
+		lo, hi := list[0].Score, list[0].Score
+		for _, hit := range list {
+			lo, hi = min(lo, hit.Score), max(hi, hit.Score)
+		}
+
+		for _, hit := range list {
+			normalized := 1.0
+			if hi > lo {
+				normalized = (hit.Score - lo) / (hi - lo)
+			}
+			scores[hit.ID] += weights[i] * normalized
+		}
+	}
+	return sortedHits(scores)
+}
+
+func sortedHits(scores map[string]float64) []Hit {
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sortHits(hits)
+	return hits
+}
+
+// sortHits orders hits best first, breaking ties by id so results are
+// stable.
+func sortHits(hits []Hit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].ID < hits[j].ID
+		}
+		return hits[i].Score > hits[j].Score
+	})
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	snippetWindow  = 160
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+)
+
+// Snippet returns the passage of text around the densest cluster of query
+// terms as HTML, with every matching word wrapped in <mark> tags. The text
+// itself is escaped so markup in a document cannot reach the page. Without
+// any match it returns the start of text.
+func Snippet(text, query string) string {
+	queryTerms := make(map[string]bool)
+	for _, term := range Terms(query) {
+		queryTerms[term] = true
+	}
+
+	var matches []Token
+	for _, token := range Analyze(text) {
+		if queryTerms[token.Term] {
+			matches = append(matches, token)
+		}
+	}
+
+	if len(matches) == 0 {
+		return html.EscapeString(truncate(text, snippetWindow))
+	}
+
+	best, bestCount := 0, 0
+	for i := range matches {
+		count := 0
+		for j := i; j < len(matches) && matches[j].Start-matches[i].Start <= snippetWindow; j++ {
+			count++
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+
+	start := max(0, matches[best].Start-snippetWindow/4)
+	start = wordBoundary(text, start)
+	end := min(len(text), start+snippetWindow)
+	for end < len(text) && text[end] != ' ' {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+
+	pos := start
+	for _, m := range matches {
+		if m.Start < start || m.End > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:m.Start]))
+		b.WriteString(highlightOpen)
+		b.WriteString(html.EscapeString(text[m.Start:m.End]))
+		b.WriteString(highlightClose)
+		pos = m.End
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+
+	if end < len(text) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+func wordBoundary(text string, i int) int {
+	for i > 0 && text[i-1] != ' ' && text[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	end := n
+	for end > 0 && text[end] != ' ' {
+		end--
+	}
+	if end == 0 {
+		// No space to break at: cut mid-word, but not mid-rune.
+		end = n
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+	return text[:end] + "..."
+}
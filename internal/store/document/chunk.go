@@ -0,0 +1,33 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chunk is a retrievable slice of a document. Heading carries the closest
+// section heading when the chunker knows it.
+type Chunk struct {
+	ID         string `json:"id"`
+	DocumentID string `json:"document_id"`
+	Index      int    `json:"index"`
+	Heading    string `json:"heading,omitempty"`
+	Content    string `json:"content"`
+}
+
+func ChunkID(documentID string, index int) string {
+	return fmt.Sprintf("%s%d", ChunkIDPrefix(documentID), index)
+}
+
+// ChunkIDPrefix is shared by every chunk of documentID and by nothing else,
+// since document IDs cannot contain '#'.
+func ChunkIDPrefix(documentID string) string {
+	return documentID + "#"
+}
+
+func ParentID(chunkID string) string {
+	if i := strings.LastIndex(chunkID, "#"); i >= 0 {
+		return chunkID[:i]
+	}
+	return chunkID
+}
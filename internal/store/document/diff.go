@@ -0,0 +1,226 @@
+package document
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	diffContext = 3
+
+	// maxDiffCells bounds the LCS table. Larger rewrites are reported as the
+	// whole old content replaced by the whole new content.
+	maxDiffCells = 4_000_000
+)
+
+// VersionDiff describes what changed between two versions of a document.
+// Patch is a unified diff of the content.
+type VersionDiff struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Changed []string `json:"changed"`
+	Patch   string   `json:"patch,omitempty"`
+}
+
+func Diff(from, to Document) VersionDiff {
+	diff := VersionDiff{From: from.Version, To: to.Version}
+
+	if from.Title != to.Title {
+		diff.Changed = append(diff.Changed, "title")
+	}
+	if from.Content != to.Content {
+		diff.Changed = append(diff.Changed, "content")
+		diff.Patch = unifiedDiff(from.Content, to.Content)
+	}
+	if !slices.Equal(from.Tags, to.Tags) {
+		diff.Changed = append(diff.Changed, "tags")
+	}
+	if !maps.Equal(from.Meta, to.Meta) {
+		diff.Changed = append(diff.Changed, "meta")
+	}
+	if from.Status != to.Status {
+		diff.Changed = append(diff.Changed, "status")
+	}
+	if from.Audience != to.Audience {
+		diff.Changed = append(diff.Changed, "audience")
+	}
+	if !equalTime(from.ValidFrom, to.ValidFrom) {
+		diff.Changed = append(diff.Changed, "valid_from")
+	}
+	if !equalTime(from.ValidUntil, to.ValidUntil) {
+		diff.Changed = append(diff.Changed, "valid_until")
+	}
+	return diff
+}
+
+// sameContent reports whether storing b over a would change anything a
+// reader can see.
+func sameContent(a, b Document) bool {
+	return a.Title == b.Title &&
+		a.Content == b.Content &&
+		slices.Equal(a.Tags, b.Tags) &&
+		maps.Equal(a.Meta, b.Meta) &&
+		a.Status == b.Status &&
+		a.Audience == b.Audience &&
+		equalTime(a.ValidFrom, b.ValidFrom) &&
+		equalTime(a.ValidUntil, b.ValidUntil)
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+type editOp byte
+
+const (
+	editEqual  editOp = ' '
+	editDelete editOp = '-'
+	editInsert editOp = '+'
+)
+
+type edit struct {
+	op   editOp
+	line string
+}
+
+func unifiedDiff(a, b string) string {
+	edits := diffLines(strings.Split(a, "\n"), strings.Split(b, "\n"))
+
+	var builder strings.Builder
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(edits); {
+		// Find the next change and open a hunk diffContext lines before it.
+		first := start
+		for first < len(edits) && edits[first].op == editEqual {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		lead := min(diffContext, first-start)
+		oldLine += first - start - lead
+		newLine += first - start - lead
+		hunkStart := first - lead
+
+		// Extend the hunk over changes separated by few enough unchanged
+		// lines that their context would overlap.
+		end := first
+		for end < len(edits) {
+			if edits[end].op != editEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == editEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*diffContext {
+				end = min(run, end+diffContext)
+				break
+			}
+			end = run
+		}
+
+		oldCount, newCount := 0, 0
+		for _, e := range edits[hunkStart:end] {
+			if e.op != editInsert {
+				oldCount++
+			}
+			if e.op != editDelete {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&builder, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, e := range edits[hunkStart:end] {
+			builder.WriteByte(byte(e.op))
+			builder.WriteString(e.line)
+			builder.WriteByte('\n')
+		}
+
+		oldLine += oldCount
+		newLine += newCount
+		start = end
+	}
+	return builder.String()
+}
+
+// diffLines computes a line edit script via the longest common subsequence,
+// after trimming the common prefix and suffix.
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []edit
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{editEqual, line})
+	}
+	edits = append(edits, lcsEdits(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{editEqual, line})
+	}
+	return edits
+}
+
+func lcsEdits(a, b []string) []edit {
+	var edits []edit
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			edits = append(edits, edit{editDelete, line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{editInsert, line})
+		}
+		return edits
+	}
+
+	// lengths[i][j] is the LCS length of a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{editEqual, a[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			edits = append(edits, edit{editDelete, a[i]})
+			i++
+		default:
+			edits = append(edits, edit{editInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{editDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{editInsert, b[j]})
+	}
+	return edits
+}
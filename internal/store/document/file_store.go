@@ -0,0 +1,273 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/jsonl"
+)
+
+const (
+	snapshotFileName = "documents.json"
+	journalFileName  = "journal.jsonl"
+	lockFileName     = "LOCK"
+
+	// compactAfter bounds how many journal entries are replayed on startup.
+	compactAfter = 1000
+)
+
+type journalOp string
+
+const (
+	journalPut    journalOp = "put"
+	journalDelete journalOp = "delete"
+)
+
+type journalEntry struct {
+	Op       journalOp `json:"op"`
+	ID       string    `json:"id,omitempty"`
+	Document *Document `json:"document,omitempty"`
+}
+
+// ErrStoreLocked is returned when another process, such as the server and
+// the ingest command at once, already has the store directory open.
+var ErrStoreLocked = errors.New("document store is in use by another process")
+
+// FileStore keeps documents in memory and makes every write durable by
+// appending it to a journal and syncing it to disk before it is applied.
+// The journal is periodically folded into a snapshot file, which is
+// replaced atomically via rename.
+type FileStore struct {
+	dir       string
+	documents map[string]Document
+	journal   *jsonl.Log
+	entries   int
+	lock      *os.File
+	created   bool
+	mu        sync.RWMutex
+}
+
+// OpenFileStore opens the store in dir, creating it if needed, and holds
+// the directory locked until Close.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:       dir,
+		documents: make(map[string]Document),
+		lock:      lock,
+	}
+
+	if err := s.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) open() error {
+	s.created = !exists(filepath.Join(s.dir, snapshotFileName)) && !exists(filepath.Join(s.dir, journalFileName))
+
+	if err := s.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := s.replayJournal(); err != nil {
+		return err
+	}
+	return s.compact()
+}
+
+// Created reports whether this open initialised the store, as opposed to
+// finding one on disk. A store whose documents were all deleted was not
+// created, so callers can seed a new store without refilling an emptied one.
+func (s *FileStore) Created() bool {
+	return s.created
+}
+
+func (s *FileStore) Get(id string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, exists := s.documents[id]
+	return doc, exists
+}
+
+func (s *FileStore) List() []Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.all()
+}
+
+func (s *FileStore) Put(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(journalEntry{Op: journalPut, Document: &doc}); err != nil {
+		return err
+	}
+
+	s.documents[doc.ID] = doc
+	return s.maybeCompact()
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(journalEntry{Op: journalDelete, ID: id}); err != nil {
+		return err
+	}
+
+	delete(s.documents, id)
+	return s.maybeCompact()
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.journal == nil {
+		return nil
+	}
+
+	err := s.journal.Close()
+	s.journal = nil
+	// Closing the lock file releases the lock.
+	if lockErr := s.lock.Close(); err == nil {
+		err = lockErr
+	}
+	return err
+}
+
+func (s *FileStore) append(entry journalEntry) error {
+	if s.journal == nil {
+		return errors.New("file store is closed")
+	}
+
+	if err := s.journal.Append(entry); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+
+	s.entries++
+	return nil
+}
+
+// maybeCompact runs after the write it follows is already durable, so a
+// failed compaction is logged rather than reported as a failed write.
+func (s *FileStore) maybeCompact() error {
+	if s.entries < compactAfter {
+		return nil
+	}
+	if err := s.compact(); err != nil {
+		log.Printf("Failed to compact document journal: %v", err)
+	}
+	return nil
+}
+
+// compact writes the current documents to a new snapshot, swaps it in and
+// starts an empty journal. A crash at any point leaves either the old
+// snapshot plus the full journal or the new snapshot, both of which replay
+// to the same state.
+func (s *FileStore) compact() error {
+	data, err := json.Marshal(s.all())
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	if err := jsonl.WriteFile(filepath.Join(s.dir, snapshotFileName), data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// The empty journal is created aside and renamed into place, so a
+	// failure leaves the current one open and in use; replaying it over the
+	// new snapshot gives the same state.
+	tmp := filepath.Join(s.dir, journalFileName+".tmp")
+	journal, err := jsonl.Create(tmp, "journal")
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, journalFileName)); err != nil {
+		journal.Close()
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	if s.journal != nil {
+		s.journal.Close()
+	}
+	s.journal = journal
+	s.entries = 0
+
+	return nil
+}
+
+func (s *FileStore) all() []Document {
+	docs := make([]Document, 0, len(s.documents))
+	for _, doc := range s.documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var docs []Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	for _, doc := range docs {
+		s.documents[doc.ID] = doc
+	}
+	return nil
+}
+
+func (s *FileStore) replayJournal() error {
+	_, err := jsonl.Read(filepath.Join(s.dir, journalFileName), "journal", func(lineNo int, line []byte) error {
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("corrupt journal entry at line %d: %w", lineNo, err)
+		}
+
+		switch entry.Op {
+		case journalPut:
+			if entry.Document == nil {
+				return fmt.Errorf("journal entry at line %d has no document", lineNo)
+			}
+			s.documents[entry.Document.ID] = *entry.Document
+		case journalDelete:
+			delete(s.documents, entry.ID)
+		default:
+			return fmt.Errorf("unknown journal operation %q at line %d", entry.Op, lineNo)
+		}
+		return nil
+	})
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,153 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter restricts which documents take part in a search. All set conditions
+// must hold; an empty filter matches everything.
+type Filter struct {
+	Tags          []string          `json:"tags,omitempty"`
+	Meta          map[string]string `json:"meta,omitempty"`
+	MetaRange     map[string]Range  `json:"meta_range,omitempty"`
+	UpdatedAfter  *time.Time        `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time        `json:"updated_before,omitempty"`
+
+	// Visibility is set by the server from who is asking, never by the
+	// client, and hides documents that reader may not see.
+	Visibility *Visibility `json:"-"`
+}
+
+// Range bounds a Meta value inclusively. Values that parse as numbers are
+// compared numerically, anything else lexically, which also orders ISO 8601
+// dates correctly.
+type Range struct {
+	Gte string `json:"gte,omitempty"`
+	Lte string `json:"lte,omitempty"`
+}
+
+func (f *Filter) Validate() error {
+	if f == nil {
+		return nil
+	}
+
+	for key, r := range f.MetaRange {
+		if r.Gte == "" && r.Lte == "" {
+			return fmt.Errorf("meta_range for %q needs gte or lte", key)
+		}
+		if r.Gte != "" && r.Lte != "" && compareValues(r.Gte, r.Lte) > 0 {
+			return fmt.Errorf("meta_range for %q has gte greater than lte", key)
+		}
+	}
+
+	if f.UpdatedAfter != nil && f.UpdatedBefore != nil && f.UpdatedAfter.After(*f.UpdatedBefore) {
+		return fmt.Errorf("updated_after must not be later than updated_before")
+	}
+
+	return nil
+}
+
+// WithVisibility returns a copy of f, which may be nil, restricted to what
+// v allows.
+func (f *Filter) WithVisibility(v Visibility) *Filter {
+	var restricted Filter
+	if f != nil {
+		restricted = *f
+	}
+	restricted.Visibility = &v
+	return &restricted
+}
+
+func (f *Filter) Matches(doc Document) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.Visibility != nil && !f.Visibility.Allows(doc) {
+		return false
+	}
+
+	if len(f.Tags) > 0 && !hasAnyTag(doc.Tags, f.Tags) {
+		return false
+	}
+
+	for key, want := range f.Meta {
+		if doc.Meta[key] != want {
+			return false
+		}
+	}
+
+	for key, r := range f.MetaRange {
+		value, exists := doc.Meta[key]
+		if !exists {
+			return false
+		}
+		if r.Gte != "" && compareValues(value, r.Gte) < 0 {
+			return false
+		}
+		if r.Lte != "" && compareValues(value, r.Lte) > 0 {
+			return false
+		}
+	}
+
+	if f.UpdatedAfter != nil && doc.UpdatedAt.Before(*f.UpdatedAfter) {
+		return false
+	}
+	if f.UpdatedBefore != nil && doc.UpdatedAt.After(*f.UpdatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+func (f *Filter) Apply(docs []Document) []Document {
+	if f == nil {
+		return docs
+	}
+
+	var results []Document
+	for _, doc := range docs {
+		if f.Matches(doc) {
+			results = append(results, doc)
+		}
+	}
+	return results
+}
+
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if strings.EqualFold(tag, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package document
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDir only creates the lock file where flock is not available; the
+// store then relies on a single process opening it.
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store lock: %w", err)
+	}
+	return f, nil
+}
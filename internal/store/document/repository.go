@@ -1,77 +1,422 @@
 package document
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/search"
 )
 
+// MetaConnector marks the documents a connector owns, so a sync can tell
+// which documents disappeared from its source. Only connectors set it;
+// documents written through the API or ingested from files have it
+// removed, so a sync never deletes them.
+const MetaConnector = "connector"
+
 type Document struct {
 	ID      string            `json:"id"`
 	Title   string            `json:"title"`
 	Content string            `json:"content"`
 	Tags    []string          `json:"tags"`
 	Meta    map[string]string `json:"meta,omitempty"`
+
+	// Status and Audience default to published and public. A document is
+	// only retrievable between ValidFrom and ValidUntil, when set.
+	Status     Status     `json:"status,omitempty"`
+	Audience   Audience   `json:"audience,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+
+	// Version counts the changes made to the document, starting at 1, and
+	// Author records who made the latest one.
+	Version int    `json:"version"`
+	Author  string `json:"author,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	ErrNotFound      = errors.New("document not found")
+	ErrAlreadyExists = errors.New("document already exists")
+	ErrRejected      = errors.New("document rejected")
+)
+
+// Sanitizer cleans a document before it is stored, or refuses it with an
+// error wrapping ErrRejected.
+type Sanitizer interface {
+	Sanitize(doc Document) (Document, error)
+}
+
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+type Change struct {
+	Type     ChangeType
+	Document Document
 }
 
 type Repository struct {
-	documents map[string]Document
+	store     Store
+	versions  VersionStore
+	keywords  *search.Index
+	sanitizer Sanitizer
 	mu        sync.RWMutex
 	counter   int
+	listeners []func(Change)
 }
 
 func NewRepository() *Repository {
+	return NewRepositoryWithStore(NewMemoryStore(), NewMemoryVersionStore())
+}
+
+func NewRepositoryWithStore(store Store, versions VersionStore) *Repository {
+	keywords := search.NewIndex()
+	for _, doc := range store.List() {
+		keywords.Put(doc.ID, keywordText(doc))
+
+		// Documents stored before versioning existed start their history
+		// with what they hold now.
+		if len(versions.Versions(doc.ID)) == 0 {
+			doc.Version = max(doc.Version, 1)
+			if err := versions.Append(doc); err != nil {
+				log.Printf("Failed to record initial version of document %s: %v", doc.ID, err)
+			}
+		}
+	}
+
 	return &Repository{
-		documents: make(map[string]Document),
+		store:    store,
+		versions: versions,
+		keywords: keywords,
 	}
 }
 
-func (r *Repository) Add(doc Document) (string, error) {
+// UseSanitizer makes every later write pass through s before it is stored
+// or reported to listeners.
+func (r *Repository) UseSanitizer(s Sanitizer) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if doc.ID == "" {
-		r.counter++
-		doc.ID = fmt.Sprintf("doc_%d", r.counter)
+	r.sanitizer = s
+}
+
+// Subscribe registers fn to be called after every add, update or delete.
+// Listeners run outside the repository lock, in registration order.
+func (r *Repository) Subscribe(fn func(Change)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *Repository) notify(change Change) {
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
+
+// Add stores doc, replacing any document with the same ID. Storing a
+// document identical to the current one does not create a new version.
+func (r *Repository) Add(doc Document) (string, error) {
+	r.mu.Lock()
+	_, exists := r.store.Get(doc.ID)
+	doc, changed, err := r.put(doc)
+	r.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return doc.ID, nil
 	}
 
-	r.documents[doc.ID] = doc
+	changeType := ChangeAdded
+	if exists {
+		changeType = ChangeUpdated
+	}
+	r.notify(Change{Type: changeType, Document: doc})
+
 	return doc.ID, nil
 }
 
+func (r *Repository) Create(doc Document) (Document, error) {
+	r.mu.Lock()
+	if _, exists := r.store.Get(doc.ID); exists && doc.ID != "" {
+		r.mu.Unlock()
+		return Document{}, fmt.Errorf("%w: %s", ErrAlreadyExists, doc.ID)
+	}
+	doc, _, err := r.put(doc)
+	r.mu.Unlock()
+	if err != nil {
+		return Document{}, err
+	}
+
+	r.notify(Change{Type: ChangeAdded, Document: doc})
+	return doc, nil
+}
+
+func (r *Repository) Update(doc Document) (Document, error) {
+	r.mu.Lock()
+	if _, exists := r.store.Get(doc.ID); !exists {
+		r.mu.Unlock()
+		return Document{}, fmt.Errorf("%w: %s", ErrNotFound, doc.ID)
+	}
+	doc, changed, err := r.put(doc)
+	r.mu.Unlock()
+	if err != nil {
+		return Document{}, err
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	r.notify(Change{Type: ChangeUpdated, Document: doc})
+	return doc, nil
+}
+
+func (r *Repository) Delete(id string) error {
+	r.mu.Lock()
+	doc, exists := r.store.Get(id)
+	if !exists {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	err := r.store.Delete(id)
+	if err == nil {
+		r.keywords.Remove(id)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to delete document %s: %w", id, err)
+	}
+
+	r.notify(Change{Type: ChangeDeleted, Document: doc})
+	return nil
+}
+
+// put stores doc as the next version of its ID and records it in the
+// history. It reports false, without writing, when doc matches the current
+// version.
+func (r *Repository) put(doc Document) (Document, bool, error) {
+	if doc.ID == "" {
+		doc.ID = r.nextID()
+	}
+	if doc.Status == "" {
+		doc.Status = StatusPublished
+	}
+	if doc.Audience == "" {
+		doc.Audience = AudiencePublic
+	}
+	if r.sanitizer != nil {
+		sanitized, err := r.sanitizer.Sanitize(doc)
+		if err != nil {
+			return Document{}, false, err
+		}
+		doc = sanitized
+	}
+
+	now := time.Now()
+	existing, exists := r.store.Get(doc.ID)
+	if exists && sameContent(existing, doc) {
+		return existing, false, nil
+	}
+	if exists {
+		doc.CreatedAt = existing.CreatedAt
+	} else if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = now
+	}
+	doc.UpdatedAt = now
+	doc.Version = r.latestVersion(doc.ID, existing) + 1
+
+	// Store the document before recording the version, so a failed write
+	// never leaves a version in the history that did not exist; if the
+	// history cannot be written, the previous document is put back.
+	if err := r.store.Put(doc); err != nil {
+		return Document{}, false, fmt.Errorf("failed to store document %s: %w", doc.ID, err)
+	}
+	if err := r.versions.Append(doc); err != nil {
+		restore := func() error { return r.store.Delete(doc.ID) }
+		if exists {
+			restore = func() error { return r.store.Put(existing) }
+		}
+		if restoreErr := restore(); restoreErr != nil {
+			log.Printf("Failed to restore document %s after a failed version write: %v", doc.ID, restoreErr)
+		}
+		return Document{}, false, fmt.Errorf("failed to record version of document %s: %w", doc.ID, err)
+	}
+	r.keywords.Put(doc.ID, keywordText(doc))
+	return doc, true, nil
+}
+
+// latestVersion also looks at the history so a document recreated after a
+// delete continues its numbering.
+func (r *Repository) latestVersion(id string, current Document) int {
+	latest := current.Version
+	if versions := r.versions.Versions(id); len(versions) > 0 {
+		latest = max(latest, versions[len(versions)-1].Version)
+	}
+	return latest
+}
+
+func (r *Repository) nextID() string {
+	for {
+		r.counter++
+		id := fmt.Sprintf("doc_%d", r.counter)
+		if _, exists := r.store.Get(id); !exists && len(r.versions.Versions(id)) == 0 {
+			return id
+		}
+	}
+}
+
 func (r *Repository) Get(id string) (Document, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	doc, exists := r.documents[id]
-	return doc, exists
+	return r.store.Get(id)
+}
+
+// Versions returns every version of the document with id, oldest first,
+// including those of a document that has since been deleted.
+func (r *Repository) Versions(id string) []Document {
+	return r.versions.Versions(id)
+}
+
+func (r *Repository) Version(id string, version int) (Document, error) {
+	for _, doc := range r.versions.Versions(id) {
+		if doc.Version == version {
+			return doc, nil
+		}
+	}
+	return Document{}, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, id, version)
+}
+
+// Rollback stores the given earlier version of a document as its newest
+// version, restoring the document if it was deleted.
+func (r *Repository) Rollback(id string, version int, author string) (Document, error) {
+	target, err := r.Version(id, version)
+	if err != nil {
+		return Document{}, err
+	}
+	target.Author = author
+
+	r.mu.Lock()
+	_, exists := r.store.Get(id)
+	doc, changed, err := r.put(target)
+	r.mu.Unlock()
+	if err != nil {
+		return Document{}, err
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	changeType := ChangeUpdated
+	if !exists {
+		changeType = ChangeAdded
+	}
+	r.notify(Change{Type: changeType, Document: doc})
+	return doc, nil
 }
 
 func (r *Repository) List() []Document {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	docs := make([]Document, 0, len(r.documents))
-	for _, doc := range r.documents {
-		docs = append(docs, doc)
+	return r.store.List()
+}
+
+func (r *Repository) Find(filter *Filter) []Document {
+	return filter.Apply(r.List())
+}
+
+// ListPage returns the documents matching filter ordered by creation time,
+// skipping offset and returning at most limit of them, plus the total number
+// of matches.
+func (r *Repository) ListPage(filter *Filter, offset, limit int) ([]Document, int) {
+	docs := r.Find(filter)
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+			return docs[i].ID < docs[j].ID
+		}
+		return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+	})
+
+	total := len(docs)
+	if offset >= total {
+		return []Document{}, total
 	}
-	return docs
+
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return docs[offset:end], total
+}
+
+// KeywordResult is a document ranked by BM25 against a keyword query, with
+// a snippet of its content highlighting the matched terms.
+type KeywordResult struct {
+	Document Document `json:"document"`
+	Score    float64  `json:"score"`
+	Snippet  string   `json:"snippet"`
 }
 
+// SearchByKeyword returns the documents matching query, best first.
 func (r *Repository) SearchByKeyword(query string) []Document {
+	results := r.Search(query, nil, 0)
+	docs := make([]Document, len(results))
+	for i, result := range results {
+		docs[i] = result.Document
+	}
+	return docs
+}
+
+// Search ranks the documents matching filter against query with BM25 and
+// returns at most limit of them; limit <= 0 returns every match.
+func (r *Repository) Search(query string, filter *Filter, limit int) []KeywordResult {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var results []Document
-	for _, doc := range r.documents {
-		if containsIgnoreCase(doc.Title, query) || containsIgnoreCase(doc.Content, query) {
-			results = append(results, doc)
+	var accept func(id string) bool
+	if filter != nil {
+		accept = func(id string) bool {
+			doc, exists := r.store.Get(id)
+			return exists && filter.Matches(doc)
+		}
+	}
+
+	hits := r.keywords.Search(query, limit, accept)
+	results := make([]KeywordResult, 0, len(hits))
+	for _, hit := range hits {
+		doc, exists := r.store.Get(hit.ID)
+		if !exists {
+			continue
 		}
+		results = append(results, KeywordResult{
+			Document: doc,
+			Score:    hit.Score,
+			Snippet:  search.Snippet(doc.Content, query),
+		})
 	}
 	return results
 }
 
-func containsIgnoreCase(s, substr string) bool {
-	s, substr = strings.ToLower(s), strings.ToLower(substr)
-	return strings.Contains(s, substr)
+// keywordText is what a document is indexed under. The title is repeated so
+// that title matches outweigh a passing mention in the body.
+func keywordText(doc Document) string {
+	return strings.Join([]string{doc.Title, doc.Title, strings.Join(doc.Tags, " "), doc.Content}, "\n")
 }
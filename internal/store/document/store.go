@@ -0,0 +1,63 @@
+package document
+
+import "sync"
+
+// Store persists documents for a Repository. Reads never fail because every
+// implementation serves them from memory; writes can, for durable stores.
+type Store interface {
+	Get(id string) (Document, bool)
+	List() []Document
+	Put(doc Document) error
+	Delete(id string) error
+	Close() error
+}
+
+type MemoryStore struct {
+	documents map[string]Document
+	mu        sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		documents: make(map[string]Document),
+	}
+}
+
+func (s *MemoryStore) Get(id string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, exists := s.documents[id]
+	return doc, exists
+}
+
+func (s *MemoryStore) List() []Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs := make([]Document, 0, len(s.documents))
+	for _, doc := range s.documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func (s *MemoryStore) Put(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.documents[doc.ID] = doc
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.documents, id)
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
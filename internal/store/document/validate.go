@@ -0,0 +1,59 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxIDLength      = 128
+	maxTitleLength   = 300
+	maxContentLength = 100000
+	maxTags          = 20
+)
+
+func (d Document) Validate() error {
+	if len(d.ID) > maxIDLength {
+		return fmt.Errorf("id must be at most %d characters", maxIDLength)
+	}
+	if strings.ContainsAny(d.ID, "/# \t\n") {
+		return fmt.Errorf("id must not contain slashes, '#' or whitespace")
+	}
+
+	if strings.TrimSpace(d.Title) == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len(d.Title) > maxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxTitleLength)
+	}
+
+	if strings.TrimSpace(d.Content) == "" {
+		return fmt.Errorf("content is required")
+	}
+	if len(d.Content) > maxContentLength {
+		return fmt.Errorf("content must be at most %d characters", maxContentLength)
+	}
+
+	if len(d.Tags) > maxTags {
+		return fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	for _, tag := range d.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("tags must not be empty")
+		}
+	}
+
+	switch d.Status {
+	case "", StatusDraft, StatusPublished:
+	default:
+		return fmt.Errorf("status must be draft or published")
+	}
+	if _, err := ParseAudience(string(d.Audience)); err != nil {
+		return err
+	}
+	if d.ValidFrom != nil && d.ValidUntil != nil && !d.ValidFrom.Before(*d.ValidUntil) {
+		return fmt.Errorf("valid_from must be earlier than valid_until")
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/junjie-w/llm-integration-patterns-experiments/internal/store/jsonl"
+)
+
+const versionsFileName = "versions.jsonl"
+
+var ErrVersionNotFound = errors.New("document version not found")
+
+// VersionStore keeps every version a document has had, oldest first. History
+// outlives the document itself so a deleted document can be restored.
+type VersionStore interface {
+	Append(doc Document) error
+	Versions(id string) []Document
+	Close() error
+}
+
+type MemoryVersionStore struct {
+	versions map[string][]Document
+	mu       sync.RWMutex
+}
+
+func NewMemoryVersionStore() *MemoryVersionStore {
+	return &MemoryVersionStore{
+		versions: make(map[string][]Document),
+	}
+}
+
+func (s *MemoryVersionStore) Append(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.versions[doc.ID] = append(s.versions[doc.ID], doc)
+	return nil
+}
+
+func (s *MemoryVersionStore) Versions(id string) []Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Document(nil), s.versions[id]...)
+}
+
+func (s *MemoryVersionStore) Close() error {
+	return nil
+}
+
+// FileVersionStore is a MemoryVersionStore backed by an append-only log.
+// History never shrinks, so unlike FileStore there is nothing to compact.
+type FileVersionStore struct {
+	*MemoryVersionStore
+	log *jsonl.Log
+	mu  sync.Mutex
+}
+
+func OpenFileVersionStore(dir string) (*FileVersionStore, error) {
+	s := &FileVersionStore{MemoryVersionStore: NewMemoryVersionStore()}
+
+	versionLog, err := jsonl.Open(filepath.Join(dir, versionsFileName), "version log", func(lineNo int, line []byte) error {
+		var doc Document
+		if err := json.Unmarshal(line, &doc); err != nil {
+			return fmt.Errorf("corrupt version log entry at line %d: %w", lineNo, err)
+		}
+		return s.MemoryVersionStore.Append(doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log = versionLog
+
+	return s, nil
+}
+
+func (s *FileVersionStore) Append(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return errors.New("version store is closed")
+	}
+
+	if err := s.log.Append(doc); err != nil {
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+
+	return s.MemoryVersionStore.Append(doc)
+}
+
+func (s *FileVersionStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
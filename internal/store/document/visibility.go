@@ -0,0 +1,86 @@
+package document
+
+import (
+	"fmt"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusDraft     Status = "draft"
+	StatusPublished Status = "published"
+)
+
+// Audience says who may read a document. Audiences are ordered: premium
+// members also see public documents, and internal agents see everything.
+type Audience string
+
+const (
+	AudiencePublic   Audience = "public"
+	AudiencePremium  Audience = "premium"
+	AudienceInternal Audience = "internal"
+)
+
+var audienceRanks = map[Audience]int{
+	AudiencePublic:   0,
+	AudiencePremium:  1,
+	AudienceInternal: 2,
+}
+
+func ParseAudience(s string) (Audience, error) {
+	if s == "" {
+		return AudiencePublic, nil
+	}
+	if _, ok := audienceRanks[Audience(s)]; !ok {
+		return "", fmt.Errorf("audience must be public, premium or internal")
+	}
+	return Audience(s), nil
+}
+
+// rank treats an unknown audience as the most restricted one.
+func (a Audience) rank() int {
+	if a == "" {
+		return audienceRanks[AudiencePublic]
+	}
+	if rank, ok := audienceRanks[a]; ok {
+		return rank
+	}
+	return audienceRanks[AudienceInternal]
+}
+
+// Visibility describes a reader: documents are visible to them when they are
+// published, inside their validity window at At, and meant for an audience
+// the reader belongs to.
+type Visibility struct {
+	Audience Audience
+	At       time.Time
+}
+
+// Allows treats documents without a status or audience, which predate these
+// fields, as published and public.
+func (v Visibility) Allows(doc Document) bool {
+	if doc.Status == StatusDraft {
+		return false
+	}
+	if doc.ValidFrom != nil && v.At.Before(*doc.ValidFrom) {
+		return false
+	}
+	if doc.ValidUntil != nil && !v.At.Before(*doc.ValidUntil) {
+		return false
+	}
+	return doc.Audience.rank() <= v.Audience.rank()
+}
+
+// ParseTime accepts RFC 3339 timestamps and plain dates, which are taken as
+// midnight UTC.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
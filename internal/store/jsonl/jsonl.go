@@ -0,0 +1,154 @@
+// Package jsonl reads and appends JSON Lines files used as append-only
+// logs, and replaces whole files durably.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Log is a JSON Lines file open for appending. It is not safe for
+// concurrent use; callers serialise appends themselves.
+type Log struct {
+	file *os.File
+	name string
+}
+
+// Read calls decode with every complete line of the file at path, in
+// order, and returns the length of those lines. A final line without a
+// newline is a write cut short by a crash that was never acknowledged, so
+// it is skipped. A missing file reads as empty. name describes the file in
+// errors and log messages, e.g. "query log".
+func Read(path, name string, decode func(lineNo int, line []byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	var valid int64
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("Ignoring incomplete %s entry at line %d", name, lineNo)
+			}
+			return valid, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		if err := decode(lineNo, line); err != nil {
+			return 0, err
+		}
+		valid += int64(len(line))
+	}
+}
+
+// Open reads the log at path like Read and opens it for appending,
+// creating it and its directory if needed. A torn final line is cut off so
+// the next append starts on a fresh line.
+func Open(path, name string, decode func(lineNo int, line []byte) error) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s directory: %w", name, err)
+	}
+
+	valid, err := Read(path, name, decode)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to truncate %s: %w", name, err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek %s: %w", name, err)
+	}
+
+	return &Log{file: f, name: name}, nil
+}
+
+// Create starts an empty log at path, discarding any existing one.
+func Create(path, name string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return &Log{file: f, name: name}, nil
+}
+
+// Append writes v as one line. The line reaches the operating system but
+// not necessarily the disk; call Sync when the caller acknowledges the
+// write as durable.
+func (l *Log) Append(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s entry: %w", l.name, err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", l.name, err)
+	}
+	return nil
+}
+
+func (l *Log) Sync() error {
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", l.name, err)
+	}
+	return nil
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// WriteFile replaces the file at path with data so that after a crash it
+// holds either the old or the new contents in full: data goes to a
+// temporary file that is synced and then renamed over path.
+func WriteFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Sync the directory too so the rename itself survives a crash.
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -3,23 +3,226 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+const defaultEmbeddingModel = "text-embedding-ada-002"
+
 type Config struct {
-	OpenAIKey string
+	OpenAIKey           string
+	EmbeddingModel      string
+	EmbeddingMetric     string
+	EmbeddingNormalize  bool
+	VectorSnapshotPath  string
+	DocumentStore       string
+	DocumentStorePath   string
+	ChunkStrategy       string
+	ChunkSize           int
+	ChunkOverlap        int
+	ConnectorsConfig    string
+	DedupCollapse       bool
+	PIIAction           string
+	PIIRulesPath        string
+	Reranker            string
+	RerankCandidates    int
+	QueryTransforms     []string
+	ContextBudget       float64
+	ReplyMaxTokens      int
+	MinAnswerConfidence float64
+	QueryLogPath        string
+	RetrievalCutoff     string
+	CutoffRatio         float64
+	MaxContextChunks    int
+	CalibrationPath     string
+	// APIKeys maps each API key to the role of its holder: public,
+	// premium, internal or admin.
+	APIKeys map[string]string
 }
 
 func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	config := &Config{}
+	var err error
 
 	config.OpenAIKey = os.Getenv("OPENAI_API_KEY")
 	if config.OpenAIKey == "" {
 		return nil, fmt.Errorf("OPENAI_API_KEY environment variable is required")
 	}
 
+	// The model and metric are checked by embeddings.NewService, which
+	// knows which ones it supports.
+	config.EmbeddingModel = os.Getenv("EMBEDDING_MODEL")
+	if config.EmbeddingModel == "" {
+		config.EmbeddingModel = defaultEmbeddingModel
+	}
+
+	config.EmbeddingMetric = os.Getenv("EMBEDDING_METRIC")
+	if config.EmbeddingMetric == "" {
+		config.EmbeddingMetric = "cosine"
+	}
+
+	if v := os.Getenv("EMBEDDING_NORMALIZE"); v != "" {
+		normalize, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EMBEDDING_NORMALIZE value %q: %w", v, err)
+		}
+		config.EmbeddingNormalize = normalize
+	}
+
+	config.VectorSnapshotPath = os.Getenv("VECTOR_SNAPSHOT_PATH")
+
+	config.DocumentStore = os.Getenv("DOCUMENT_STORE")
+	switch config.DocumentStore {
+	case "":
+		config.DocumentStore = "memory"
+	case "memory", "file":
+	default:
+		return nil, fmt.Errorf("invalid DOCUMENT_STORE value %q: must be memory or file", config.DocumentStore)
+	}
+
+	config.DocumentStorePath = os.Getenv("DOCUMENT_STORE_PATH")
+	if config.DocumentStorePath == "" {
+		config.DocumentStorePath = "data/documents"
+	}
+
+	config.ChunkStrategy = os.Getenv("CHUNK_STRATEGY")
+	if config.ChunkStrategy == "" {
+		config.ChunkStrategy = "markdown"
+	}
+
+	if config.ChunkSize, err = intEnv("CHUNK_SIZE", 200); err != nil {
+		return nil, err
+	}
+	if config.ChunkOverlap, err = intEnv("CHUNK_OVERLAP", 40); err != nil {
+		return nil, err
+	}
+
+	config.ConnectorsConfig = os.Getenv("CONNECTORS_CONFIG")
+
+	if v := os.Getenv("DEDUP_COLLAPSE"); v != "" {
+		collapse, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEDUP_COLLAPSE value %q: %w", v, err)
+		}
+		config.DedupCollapse = collapse
+	}
+
+	config.PIIAction = os.Getenv("PII_ACTION")
+	switch config.PIIAction {
+	case "":
+		config.PIIAction = "mask"
+	case "mask", "reject", "off":
+	default:
+		return nil, fmt.Errorf("invalid PII_ACTION value %q: must be mask, reject or off", config.PIIAction)
+	}
+
+	config.PIIRulesPath = os.Getenv("PII_RULES")
+
+	config.Reranker = os.Getenv("RERANKER")
+	switch config.Reranker {
+	case "":
+		config.Reranker = "lexical"
+	case "none", "lexical", "llm-pointwise", "llm-listwise":
+	default:
+		return nil, fmt.Errorf("invalid RERANKER value %q: must be none, lexical, llm-pointwise or llm-listwise", config.Reranker)
+	}
+
+	if config.RerankCandidates, err = intEnv("RERANK_CANDIDATES", 20); err != nil {
+		return nil, err
+	}
+
+	for _, transform := range strings.Split(os.Getenv("QUERY_TRANSFORMS"), ",") {
+		switch transform = strings.TrimSpace(transform); transform {
+		case "":
+		case "rewrite", "multi_query", "hyde":
+			config.QueryTransforms = append(config.QueryTransforms, transform)
+		default:
+			return nil, fmt.Errorf("invalid QUERY_TRANSFORMS value %q: must be a comma separated list of rewrite, multi_query and hyde", transform)
+		}
+	}
+
+	config.ContextBudget = 0.25
+	if v := os.Getenv("CONTEXT_BUDGET"); v != "" {
+		share, err := strconv.ParseFloat(v, 64)
+		if err != nil || share <= 0 || share > 1 {
+			return nil, fmt.Errorf("invalid CONTEXT_BUDGET value %q: must be a share of the context window between 0 and 1", v)
+		}
+		config.ContextBudget = share
+	}
+
+	if config.ReplyMaxTokens, err = intEnv("REPLY_MAX_TOKENS", 300); err != nil {
+		return nil, err
+	}
+
+	config.MinAnswerConfidence = 0.3
+	if v := os.Getenv("MIN_ANSWER_CONFIDENCE"); v != "" {
+		confidence, err := strconv.ParseFloat(v, 64)
+		if err != nil || confidence < 0 || confidence > 1 {
+			return nil, fmt.Errorf("invalid MIN_ANSWER_CONFIDENCE value %q: must be between 0 and 1", v)
+		}
+		config.MinAnswerConfidence = confidence
+	}
+
+	config.QueryLogPath = os.Getenv("QUERY_LOG_PATH")
+
+	config.RetrievalCutoff = os.Getenv("RETRIEVAL_CUTOFF")
+	switch config.RetrievalCutoff {
+	case "":
+		config.RetrievalCutoff = "relative"
+	case "fixed", "relative", "gap":
+	default:
+		return nil, fmt.Errorf("invalid RETRIEVAL_CUTOFF value %q: must be fixed, relative or gap", config.RetrievalCutoff)
+	}
+
+	config.CutoffRatio = 0.5
+	if v := os.Getenv("CUTOFF_RATIO"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid CUTOFF_RATIO value %q: must be a share of the best score between 0 and 1", v)
+		}
+		config.CutoffRatio = ratio
+	}
+
+	if config.MaxContextChunks, err = intEnv("MAX_CONTEXT_CHUNKS", 6); err != nil {
+		return nil, err
+	}
+	if config.MaxContextChunks < 1 || config.MaxContextChunks > 20 {
+		return nil, fmt.Errorf("invalid MAX_CONTEXT_CHUNKS value %d: must be between 1 and 20", config.MaxContextChunks)
+	}
+
+	config.CalibrationPath = os.Getenv("CALIBRATION_PATH")
+
+	config.APIKeys = make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, role, ok := strings.Cut(entry, ":")
+		switch {
+		case !ok || key == "":
+			return nil, fmt.Errorf("invalid API_KEYS entry: must be a comma separated list of key:role")
+		case role != "public" && role != "premium" && role != "internal" && role != "admin":
+			return nil, fmt.Errorf("invalid API_KEYS role %q: must be public, premium, internal or admin", role)
+		}
+		config.APIKeys[key] = role
+	}
+
 	return config, nil
 }
+
+func intEnv(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %w", key, v, err)
+	}
+	return n, nil
+}